@@ -0,0 +1,287 @@
+package gongo
+
+import "math/bits"
+
+// === Chains ===
+
+// The board keeps track of chains as stones are placed and captured, so
+// that it knows each chain's liberties without walking the chain. Every
+// stone has the point of its chain's head (one of the chain's stones), and
+// the stones of a chain are linked in a circle through nextStone. Each head
+// has a set of liberties with one bit per point, and a count of them that's
+// updated along with the set.
+//
+// Placing a stone takes a liberty from each chain next to it and merges the
+// friendly ones; capturing a chain gives its points back as liberties to the
+// chains around it. Each merge is recorded, so that undo can split the chains
+// again by walking only the stones of the chain that was joined to the other.
+
+// Returns the liberty set of the chain with the given head.
+func (b *board) libertySet(head pt) []uint64 {
+	start := int(head) * b.libertyWords
+	return b.chainLiberties[start : start+b.libertyWords]
+}
+
+func (b *board) addLiberty(head, p pt) {
+	word := &b.chainLiberties[int(head)*b.libertyWords+int(p)/64]
+	bit := uint64(1) << (uint(p) % 64)
+	if *word&bit == 0 {
+		*word |= bit
+		b.libertyCounts[head]++
+	}
+}
+
+func (b *board) removeLiberty(head, p pt) {
+	word := &b.chainLiberties[int(head)*b.libertyWords+int(p)/64]
+	bit := uint64(1) << (uint(p) % 64)
+	if *word&bit != 0 {
+		*word &^= bit
+		b.libertyCounts[head]--
+	}
+}
+
+func (b *board) clearLiberties(head pt) {
+	liberties := b.libertySet(head)
+	for i := range liberties {
+		liberties[i] = 0
+	}
+	b.libertyCounts[head] = 0
+}
+
+// Returns the number of liberties of the chain containing the given stone.
+func (b *board) libertyCount(target pt) int { return b.libertyCounts[b.chainHead[target]] }
+
+// Returns true if the chain containing the given stone has any liberties.
+func (b *board) hasLiberties(target pt) bool { return b.libertyCounts[b.chainHead[target]] > 0 }
+
+// Returns true if the given point is the only liberty of the chain
+// containing the given stone.
+func (b *board) isOnlyLiberty(target, liberty pt) bool {
+	head := b.chainHead[target]
+	return b.libertyCounts[head] == 1 &&
+		b.chainLiberties[int(head)*b.libertyWords+int(liberty)/64]&(1<<(uint(liberty)%64)) != 0
+}
+
+// Counts the liberties of the chain containing the given stone, stopping
+// when max liberties have been found. The liberties found are put in
+// b.liberties. Also returns the number of stones in the chain.
+func (b *board) countLiberties(target pt, max int) (libertyCount, chainCount int) {
+	head := b.chainHead[target]
+	if b.libertyCounts[head] == 0 {
+		return 0, b.chainSize[head]
+	}
+	for i, word := range b.libertySet(head) {
+		for word != 0 && libertyCount < max {
+			b.liberties[libertyCount] = pt(i*64 + bits.TrailingZeros64(word))
+			libertyCount++
+			word &= word - 1
+		}
+	}
+	return libertyCount, b.chainSize[head]
+}
+
+// Puts the stones of the chain containing the given stone in b.chainPoints
+// and returns how many there are.
+func (b *board) listChain(target pt) (chainCount int) {
+	p := target
+	for {
+		b.chainPoints[chainCount] = p
+		chainCount++
+		p = b.nextStone[p]
+		if p == target {
+			return chainCount
+		}
+	}
+}
+
+// Puts a stone on an empty point, joining it to the friendly chains next to
+// it and taking a liberty from the others. Doesn't capture anything.
+func (b *board) placeStone(p pt, stone cell) {
+	b.cells[p] = stone
+	b.hash ^= zobristStones[stone][p]
+	b.chainHead[p] = p
+	b.nextStone[p] = p
+	b.chainSize[p] = 1
+	b.clearLiberties(p)
+
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := p + b.dirOffset[dir]
+		b.neighborCounts[neighborPt]++
+		switch b.cells[neighborPt] {
+		case EMPTY:
+			b.addLiberty(p, neighborPt)
+		case stone, stone ^ 3:
+			b.removeLiberty(b.chainHead[neighborPt], p)
+		}
+	}
+
+	// Merge after the liberties are done, so that the merged chain's
+	// liberties don't change again before the next move. (splitChains
+	// depends on that.)
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := p + b.dirOffset[dir]
+		if b.cells[neighborPt] == stone {
+			b.mergeChains(b.chainHead[p], b.chainHead[neighborPt])
+		}
+	}
+}
+
+// A merge of two chains by placeStone, recorded so that undo can split them.
+// The joined chain's size is saved too, since its head's entries may be
+// reused if the merged chain is captured.
+type chainMerge struct {
+	head, other       pt  // the head that was kept, and the head of the chain joined to it
+	headLibertyCount  int // the kept head's liberty count before the merge
+	otherLibertyCount int
+	otherSize         int
+	firstWord         int // where this merge's words start in b.mergeWords
+}
+
+// A word of liberties from the joined chain, along with the kept head's
+// word at the same index before the merge. Only the joined chain's nonzero
+// words are saved, since the others didn't change the kept head's set.
+type mergedWord struct {
+	index       int
+	head, other uint64
+}
+
+// Joins two chains, keeping the head of the larger one. The merge is added
+// to b.merges, and the joined chain's nonzero liberty words to b.mergeWords.
+func (b *board) mergeChains(head, other pt) {
+	if head == other {
+		return
+	}
+	if b.chainSize[head] < b.chainSize[other] {
+		head, other = other, head
+	}
+	b.merges[b.mergeCount] = chainMerge{head, other, b.libertyCounts[head], b.libertyCounts[other], b.chainSize[other], b.mergeWordCount}
+	b.mergeCount++
+
+	p := other
+	for {
+		b.chainHead[p] = head
+		p = b.nextStone[p]
+		if p == other {
+			break
+		}
+	}
+	b.nextStone[head], b.nextStone[other] = b.nextStone[other], b.nextStone[head]
+	b.chainSize[head] += b.chainSize[other]
+
+	liberties := b.libertySet(head)
+	for i, word := range b.libertySet(other) {
+		if word != 0 {
+			b.mergeWords[b.mergeWordCount] = mergedWord{i, liberties[i], word}
+			b.mergeWordCount++
+			b.libertyCounts[head] += bits.OnesCount64(word &^ liberties[i])
+			liberties[i] |= word
+		}
+	}
+}
+
+// Undoes the merges after the first mergeCount, latest first. The stones
+// of each chain that was joined to another get their own head again, and
+// both heads get back their sizes and liberties. This needs the stones of
+// the merged chains to be in the same order as right after the merges, and
+// the kept head's liberties to be the same as right after the merge.
+func (b *board) splitChains(mergeCount int) {
+	for b.mergeCount > mergeCount {
+		b.mergeCount--
+		m := b.merges[b.mergeCount]
+		b.nextStone[m.head], b.nextStone[m.other] = b.nextStone[m.other], b.nextStone[m.head]
+		for p := m.other; ; {
+			b.chainHead[p] = m.other
+			if p = b.nextStone[p]; p == m.other {
+				break
+			}
+		}
+		b.chainSize[m.head] -= m.otherSize
+		b.chainSize[m.other] = m.otherSize
+
+		b.clearLiberties(m.other)
+		head, other := b.libertySet(m.head), b.libertySet(m.other)
+		for _, w := range b.mergeWords[m.firstWord:b.mergeWordCount] {
+			head[w.index] = w.head
+			other[w.index] = w.other
+		}
+		b.mergeWordCount = m.firstWord
+		b.libertyCounts[m.head] = m.headLibertyCount
+		b.libertyCounts[m.other] = m.otherLibertyCount
+	}
+}
+
+// Puts back the links between the stones of a chain that was captured, from
+// its part of b.captured. (The stones are in the order capture found them,
+// starting with the head.) The chain has no liberties.
+func (b *board) restoreChain(stones []pt) {
+	head := stones[0] & MOVE_TO_PT_MASK
+	for i, p := range stones {
+		next := head
+		if i+1 < len(stones) {
+			next = stones[i+1]
+		}
+		b.chainHead[p&MOVE_TO_PT_MASK] = head
+		b.nextStone[p&MOVE_TO_PT_MASK] = next
+	}
+	b.chainSize[head] = len(stones)
+	b.clearLiberties(head)
+}
+
+// Recomputes the chains containing the given point and its neighbors from
+// the stones on the board, skipping stones already marked with
+// CELL_IN_CHAIN. The stones of each rebuilt chain are marked and added to
+// b.chainPoints starting at the given index; returns the new end. (The
+// caller clears the marks with clearChainMarks.)
+func (b *board) rebuildChainsAround(p pt, end int) int {
+	end = b.rebuildChain(p, end)
+	for dir := 0; dir < 4; dir++ {
+		end = b.rebuildChain(p+b.dirOffset[dir], end)
+	}
+	return end
+}
+
+func (b *board) rebuildChain(target pt, end int) int {
+	stone := b.cells[target]
+	if stone != WHITE && stone != BLACK {
+		return end // empty, edge, or already rebuilt
+	}
+	head := target
+	b.clearLiberties(head)
+
+	start := end
+	b.chainPoints[end] = target
+	end++
+	b.cells[target] |= CELL_IN_CHAIN
+	for visited := start; visited < end; visited++ {
+		thisPt := b.chainPoints[visited]
+		for dir := 0; dir < 4; dir++ {
+			neighborPt := thisPt + b.dirOffset[dir]
+			switch b.cells[neighborPt] {
+			case EMPTY:
+				b.addLiberty(head, neighborPt)
+			case stone:
+				b.chainPoints[end] = neighborPt
+				end++
+				b.cells[neighborPt] |= CELL_IN_CHAIN
+			}
+		}
+	}
+
+	for i := start; i < end; i++ {
+		next := i + 1
+		if next == end {
+			next = start
+		}
+		b.chainHead[b.chainPoints[i]] = head
+		b.nextStone[b.chainPoints[i]] = b.chainPoints[next]
+	}
+	b.chainSize[head] = end - start
+	return end
+}
+
+// Clears CELL_IN_CHAIN from the first count stones in b.chainPoints.
+func (b *board) clearChainMarks(count int) {
+	for i := 0; i < count; i++ {
+		b.cells[b.chainPoints[i]] ^= CELL_IN_CHAIN
+	}
+}
@@ -0,0 +1,157 @@
+package gongo
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestChainsDuringRandomGames(t *testing.T) {
+	random := &randomness{src: rand.NewSource(1)}
+	var b board
+	for size := 2; size <= 9; size++ {
+		for _, suicideAllowed := range []bool{false, true} {
+			b.clearBoard(size)
+			b.suicideAllowed = suicideAllowed
+			for b.moveCount < len(b.allPoints)*2 {
+				b.playRandomMove(random)
+				checkChains(t, &b)
+			}
+			for b.undo() {
+				checkChains(t, &b)
+			}
+		}
+	}
+}
+
+func TestChainsAfterSetStone(t *testing.T) {
+	b := makeBoard(`
+.....
+.@@@.
+.....
+.....
+.....`)
+	b.SetStone(Empty, 3, 4)
+	checkChains(t, &b)
+	b.SetStone(Black, 3, 4)
+	checkChains(t, &b)
+	b.SetStone(White, 3, 4)
+	checkChains(t, &b)
+}
+
+func TestMergeChains(t *testing.T) {
+	b := makeBoard(`
+.....
+.@.@.
+.....
+.@.@.
+.....`)
+	b.Play(Black, 2, 3)
+	b.Play(Black, 3, 2)
+	b.Play(Black, 4, 3)
+	b.Play(Black, 3, 4)
+	b.Play(Black, 3, 3)
+	checkChains(t, &b)
+	checkLiberties(t, &b, 2, 2, 20, 12, 9)
+
+	// undo splits them again
+	for b.undo() {
+		checkChains(t, &b)
+	}
+	checkLiberties(t, &b, 2, 2, 20, 4, 1)
+}
+
+func TestUndoCaptureOfMergedChain(t *testing.T) {
+	b := makeBoard(`
+.....
+.O...
+O@.O.
+.O...
+.....`)
+	b.Play(Black, 3, 3) // joins B3
+	b.Play(White, 3, 4)
+	b.Play(Black, 5, 1)
+	b.Play(White, 3, 2) // captures both stones
+	checkBoard(t, &b, `
+.....
+.OO..
+O..O.
+.OO..
+....@`)
+	// play on the captured points, then take it all back
+	b.Play(Black, 2, 3)
+	b.Play(White, 5, 2)
+	b.Play(Black, 3, 3)
+	checkChains(t, &b)
+	for b.undo() {
+		checkChains(t, &b)
+	}
+}
+
+func TestUndoMoveThatMergesAndCaptures(t *testing.T) {
+	b := makeBoard(`
+O.O
+O@@
+@.@`)
+	b.Play(Black, 2, 3) // joins the chain below and captures both white chains
+	checkChains(t, &b)
+	b.undo()
+	checkChains(t, &b)
+	checkBoard(t, &b, `
+O.O
+O@@
+@.@`)
+}
+
+// Checks the chains and liberties against ones found by walking the board.
+func checkChains(t *testing.T, b *board) {
+	for _, p := range b.allPoints {
+		if b.cells[p] != BLACK && b.cells[p] != WHITE {
+			continue
+		}
+		chain, liberties := walkChain(b, p)
+		for q := range chain {
+			if b.chainHead[q] != b.chainHead[p] {
+				t.Fatalf("stones %v and %v are in the same chain but have different heads", p, q)
+			}
+		}
+		if actual := b.listChain(p); actual != len(chain) {
+			t.Fatalf("expected %v stones in the chain at %v but the list has %v", len(chain), p, actual)
+		}
+		libertyCount, chainCount := b.countLiberties(p, len(b.allPoints))
+		if chainCount != len(chain) {
+			t.Fatalf("expected %v stones in the chain at %v but got %v", len(chain), p, chainCount)
+		}
+		if b.libertyCount(p) != len(liberties) {
+			t.Fatalf("expected a count of %v liberties for the chain at %v but got %v", len(liberties), p, b.libertyCount(p))
+		}
+		if libertyCount != len(liberties) {
+			t.Fatalf("expected %v liberties for the chain at %v but got %v", len(liberties), p, libertyCount)
+		}
+		for _, liberty := range b.liberties[:libertyCount] {
+			if !liberties[liberty] {
+				t.Fatalf("%v isn't a liberty of the chain at %v", liberty, p)
+			}
+		}
+	}
+}
+
+func walkChain(b *board, start pt) (chain, liberties map[pt]bool) {
+	chain = map[pt]bool{start: true}
+	liberties = map[pt]bool{}
+	todo := []pt{start}
+	for len(todo) > 0 {
+		p := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		for dir := 0; dir < 4; dir++ {
+			neighborPt := p + b.dirOffset[dir]
+			switch {
+			case b.cells[neighborPt] == EMPTY:
+				liberties[neighborPt] = true
+			case b.cells[neighborPt] == b.cells[start] && !chain[neighborPt]:
+				chain[neighborPt] = true
+				todo = append(todo, neighborPt)
+			}
+		}
+	}
+	return chain, liberties
+}
@@ -1,24 +1,44 @@
 package main
 
 import (
-	"github.com/skybrian/Gongo"
+	"flag"
 	"fmt"
+	"github.com/skybrian/Gongo"
+	_ "github.com/skybrian/Gongo/sgf" // for loadsgf and printsgf
 	"io"
 	"os"
 	"strconv"
 )
 
+var (
+	threads  = flag.Int("threads", 1, "number of goroutines to run playouts on")
+	moveTime = flag.Duration("movetime", 0, "time to think about each move, such as 5s")
+	resign   = flag.Float64("resign", 0, "resign when the win rate stays below this, such as 0.1")
+	ponder   = flag.Bool("ponder", false, "keep searching while the opponent thinks")
+	heavy    = flag.Bool("heavy", false, "use heavy playouts, which are slower but play better moves")
+)
+
 func UsageError() {
-	fmt.Fprintf(os.Stderr, "Usage: %v [sampleCount]\n\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "Usage: %v [-threads n] [-movetime t] [-resign rate] [-ponder] [-heavy] [sampleCount]\n\n", os.Args[0])
 	os.Exit(1)
 }
 
 func main() {
+	flag.Usage = UsageError
+	flag.Parse()
+
 	var conf gongo.Config
-	if len(os.Args) == 1 {
-		conf.SampleCount = 1000
-	} else if len(os.Args) == 2 {
-		val, err := strconv.Atoi(os.Args[1])
+	conf.Threads = *threads
+	conf.MoveTime = *moveTime
+	conf.ResignThreshold = *resign
+	conf.Ponder = *ponder
+	if *heavy {
+		conf.Playouts = gongo.HeavyPlayouts
+	}
+	if flag.NArg() == 0 {
+		// use the default: 1000 samples, or no limit with -movetime
+	} else if flag.NArg() == 1 {
+		val, err := strconv.Atoi(flag.Arg(0))
 		if err != nil {
 			UsageError()
 		}
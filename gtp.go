@@ -3,13 +3,13 @@ package gongo
 import (
 	"bufio"
 	"bytes"
-	"errors"
 	"fmt"
 	"io"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // The gongo package handles I/O for Go-playing robots written in Go.
@@ -31,29 +31,64 @@ import (
 // Executes GTP commands using the specified robot.
 // Returns nil after the "quit" command is handled,
 // or non nil for an I/O error (which could be EOF).
+//
+// Commands are read in a separate goroutine, so that a long-running command
+// (such as lz-analyze) can keep writing output until the next command arrives.
 func Run(robot GoRobot, input io.Reader, out io.Writer) error {
-	in := bufio.NewReader(input)
+	commands := make(chan command)
+	done := make(chan struct{})
+	defer close(done)
+	go readCommands(bufio.NewReader(input), commands, done)
+
+	next := <-commands
 	for {
-		command, args, err := parseCommand(in)
-		if err != nil {
-			return err
+		if next.err != nil {
+			return next.err
 		}
+		cmd := next
 
-		next_handler, ok := handlers[command]
+		// The robot may be pondering; it has to stop before handling a command.
+		if searcher, ok := robot.(GoBackgroundSearcher); ok {
+			searcher.StopSearch()
+		}
+
+		next_handler, ok := handlers[cmd.name]
 		if !ok {
 			fmt.Fprint(out, error_("unknown command"))
+			next = <-commands
+			continue
+		}
+
+		response := next_handler(request{robot, cmd.args})
+		if response.stream != nil {
+			next = runStream(response.stream, out, commands)
 			continue
 		}
 
-		fmt.Fprint(out, next_handler(request{robot, args}))
+		fmt.Fprint(out, response)
 
-		if command == "quit" {
+		if cmd.name == "quit" {
 			break
 		}
+		next = <-commands
 	}
 	return nil
 }
 
+// A GTP command that can be added to the driver by another package. It
+// returns the response message and whether the command succeeded.
+type Command func(robot GoRobot, args []string) (message string, ok bool)
+
+// Adds a command to the ones handled by Run, replacing any existing
+// command with the same name. This should be called from an init function,
+// before Run starts.
+func RegisterCommand(name string, command Command) {
+	handlers[name] = func(req request) response {
+		message, ok := command(req.robot, req.args)
+		return response{message: message, success: ok}
+	}
+}
+
 // GTP protocol doesn't support larger than 25x25
 const MaxBoardSize = 25
 
@@ -63,15 +98,28 @@ type GoBoard interface {
 	GetCell(x, y int) Color
 
 	// Adds a move to the board. Moves can be added for either side in any
-	// order, for example to set up a position. If the same player plays twice,
-	// it's assumed that the other player passed. The board automatically
-	// handle captures.
+	// order. If the same player plays twice, the other player doesn't pass;
+	// the move is played as if it were that player's turn. The board
+	// automatically handle captures.
 	// The x and y coordinates start at 1, where x goes from left to right
 	// and y from bottom to top. Playing at (0,0) means pass.
 	// Returns:
 	//   ok - true if the move was accepted or false for an illegal move
 	//   message - status or error message, for debugging. May be empty.
 	Play(c Color, x, y int) (ok bool, message string)
+
+	// Adds a stone to the board without making a move, to set up a position
+	// (for example, handicap stones). Setting a point to Empty removes the
+	// stone. Setup stones don't capture and don't count as moves, so they
+	// can only be added before the first move.
+	// Returns the same as Play.
+	SetStone(c Color, x, y int) (ok bool, message string)
+
+	// Returns the color of the player who moves next.
+	GetToPlay() Color
+
+	// Changes who moves next, without making a move.
+	SetToPlay(c Color)
 }
 
 type GoRobot interface {
@@ -92,6 +140,106 @@ type GoRobot interface {
 	GoBoard
 }
 
+// An optional interface for robots that can budget their thinking time.
+// The controller calls these methods when it knows the time limits.
+type GoTimedRobot interface {
+	// Sets the time limits for each player. Called at the start of a game.
+	SetTimeSettings(settings TimeSettings)
+
+	// Tells the robot how much time a player has left. If stones is zero,
+	// the player is in main time. Otherwise, the player is in byo-yomi and
+	// timeLeft is the time left in the current period; for Canadian byo-yomi,
+	// stones is the number of stones left to play in this period, and for
+	// Japanese byo-yomi, it's the number of periods left.
+	SetTimeLeft(color Color, timeLeft time.Duration, stones int)
+}
+
+// An optional interface for robots that can take back moves.
+type GoUndoRobot interface {
+	// Takes back the last move, restoring the previous position exactly,
+	// including which side is to move. Returns false if there's no move
+	// to take back.
+	Undo() (ok bool)
+}
+
+// An optional interface for robots that can play under different ko rules.
+type GoKoRuleRobot interface {
+	GetKoRule() KoRule
+
+	// Changes which repeated positions are illegal. Normally called at the
+	// start of a game.
+	SetKoRule(rule KoRule)
+}
+
+// An optional interface for robots that can play under different rules.
+type GoRulesRobot interface {
+	GetRules() Rules
+
+	// Changes the rules. Normally called at the start of a game.
+	SetRules(rules Rules)
+}
+
+// An optional interface for robots that can score the game at the end.
+type GoScorer interface {
+	// Returns the score of the current position from Black's point of view
+	// (Black's points minus White's, including komi and any handicap
+	// compensation), not counting dead stones.
+	GetFinalScore() float64
+
+	// Returns whether the stone at the given point is alive, dead, or in seki.
+	GetStoneStatus(x, y int) StoneStatus
+}
+
+// An optional interface for robots that can report the game played so far,
+// so that it can be saved.
+type GoRecorder interface {
+	GetKomi() float64
+
+	// Returns the stones placed with SetStone before the first move.
+	GetSetup() []Move
+
+	// Returns the number of handicap stones in the setup, or 0 if the setup
+	// isn't a handicap.
+	GetHandicap() int
+
+	// Returns each move played so far, in order, including passes.
+	GetMoves() []Move
+}
+
+// An optional interface for robots that can choose where to put their
+// handicap stones.
+type GoHandicapRobot interface {
+	// Places up to the given number of handicap stones for Black on an empty
+	// board, and returns where they went. White plays next.
+	PlaceFreeHandicap(count int) []Vertex
+}
+
+// An optional interface for robots that can explain what they think of
+// a position.
+type GoAnalyzer interface {
+	// Searches the current position and returns statistics from the playouts.
+	Analyze() *Analysis
+}
+
+// An optional interface for robots that can keep searching in the
+// background, for example to show their analysis while a user thinks.
+type GoBackgroundSearcher interface {
+	// Starts searching the current position, with the given player to move,
+	// in another goroutine. The search runs until StopSearch is called.
+	// No other methods should be called in the meantime, except
+	// GetSearchStats. (A robot may also start a background search on its
+	// own, such as pondering after GenMove. Run stops it when the next
+	// command arrives.)
+	StartSearch(color Color)
+
+	// Returns statistics for each move searched so far, most visited first.
+	GetSearchStats() []MoveStats
+
+	// Stops the background search and waits for it to finish. Does nothing
+	// if no search is running.
+	StopSearch()
+}
+
 // === types used by the GoRobot interface ===
 
 type Color int
@@ -154,6 +302,270 @@ func (m MoveResult) String() string {
 	panic("invalid move result")
 }
 
+// Which repeated positions are illegal.
+type KoRule int
+
+const (
+	// A move may not recreate any earlier board position.
+	PositionalSuperko KoRule = 0
+
+	// A move may not recreate an earlier board position with the same
+	// player to move.
+	SituationalSuperko KoRule = 1
+
+	// Only retaking a ko immediately is illegal. Longer cycles (such as a
+	// triple ko) are allowed.
+	SimpleKo KoRule = 2
+)
+
+// Parses a ko rule: "positional", "situational", or "simple", optionally
+// followed by "superko" or "ko" as in String.
+func ParseKoRule(input string) (rule KoRule, ok bool) {
+	switch strings.ToLower(input) {
+	case "positional", "positional superko":
+		return PositionalSuperko, true
+	case "situational", "situational superko":
+		return SituationalSuperko, true
+	case "simple", "simple ko":
+		return SimpleKo, true
+	}
+	return PositionalSuperko, false
+}
+
+func (k KoRule) String() string {
+	switch k {
+	case PositionalSuperko:
+		return "positional superko"
+	case SituationalSuperko:
+		return "situational superko"
+	case SimpleKo:
+		return "simple ko"
+	}
+	panic("invalid ko rule")
+}
+
+// How the points are counted at the end of the game.
+type Scoring int
+
+const (
+	AreaScoring      Scoring = 0 // stones on the board plus surrounded points
+	TerritoryScoring Scoring = 1 // surrounded points plus prisoners
+)
+
+func (s Scoring) String() string {
+	switch s {
+	case AreaScoring:
+		return "area scoring"
+	case TerritoryScoring:
+		return "territory scoring"
+	}
+	panic("invalid scoring")
+}
+
+// How many extra points White gets in a handicap game, in addition to komi.
+type HandicapCompensation int
+
+const (
+	NoCompensation              HandicapCompensation = 0
+	CompensationPerStone        HandicapCompensation = 1 // a point for each handicap stone
+	CompensationAfterFirstStone HandicapCompensation = 2 // a point for each stone after the first
+)
+
+// Returns the points White gets for the given number of handicap stones.
+func (h HandicapCompensation) Points(handicap int) int {
+	switch {
+	case handicap < 2:
+		return 0
+	case h == CompensationPerStone:
+		return handicap
+	case h == CompensationAfterFirstStone:
+		return handicap - 1
+	}
+	return 0
+}
+
+// A rule set. The zero value is area scoring with positional superko,
+// where suicide is illegal.
+type Rules struct {
+	Scoring Scoring
+	KoRule  KoRule
+
+	// Whether a move may capture the player's own stones. (Capturing a
+	// single stone this way is usually illegal anyway, because it repeats
+	// the position.)
+	SuicideAllowed bool
+
+	// If set, a player who passes gives the opponent a prisoner. (Under
+	// territory scoring, this makes the result the same as area scoring.)
+	PassStones bool
+
+	HandicapCompensation HandicapCompensation
+}
+
+var (
+	TrompTaylorRules = Rules{Scoring: AreaScoring, KoRule: PositionalSuperko, SuicideAllowed: true}
+	ChineseRules     = Rules{Scoring: AreaScoring, KoRule: PositionalSuperko, HandicapCompensation: CompensationPerStone}
+	JapaneseRules    = Rules{Scoring: TerritoryScoring, KoRule: SimpleKo}
+	NewZealandRules  = Rules{Scoring: AreaScoring, KoRule: SituationalSuperko, SuicideAllowed: true}
+
+	// AGA rules allow counting either way. Area counting is used here; it
+	// needs the compensation for handicap stones, which territory counting
+	// with pass stones gets automatically.
+	AGARules = Rules{Scoring: AreaScoring, KoRule: SituationalSuperko,
+		HandicapCompensation: CompensationAfterFirstStone}
+)
+
+func (r Rules) String() string {
+	parts := []string{r.Scoring.String(), r.KoRule.String()}
+	if r.SuicideAllowed {
+		parts = append(parts, "suicide allowed")
+	}
+	if r.PassStones {
+		parts = append(parts, "pass stones")
+	}
+	switch r.HandicapCompensation {
+	case CompensationPerStone:
+		parts = append(parts, "handicap compensation N")
+	case CompensationAfterFirstStone:
+		parts = append(parts, "handicap compensation N-1")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// A move by one player. The coordinates are the same as for GoBoard.Play;
+// (0,0) means a pass.
+type Move struct {
+	Color Color
+	X, Y  int
+}
+
+// A point on the board, using the same coordinates as GoBoard.Play.
+type Vertex struct {
+	X, Y int
+}
+
+// The result of analyzing a position: how often each point was owned by each
+// player at the end of the playouts (under area scoring), and what the search
+// thought of each move.
+type Analysis struct {
+	Size     int
+	Playouts int
+
+	// The fraction of playouts that ended with each point owned by each player,
+	// indexed by [x][y] with the same coordinates as GoBoard. (Row and column
+	// zero aren't used.)
+	Black, White [][]float64
+
+	// Search statistics for each move the player to move could make, indexed
+	// the same way. Visits is zero for moves that weren't searched.
+	Visits   [][]int
+	WinRates [][]float64 // the fraction of a move's playouts that the player to move won
+
+	// The moves the search expects to be played next, starting with the best one.
+	PrincipalVariation []Move
+
+	// The empty points that are eyes, where the Color is the player who owns
+	// the eye. (The robot doesn't consider filling in its own eyes.)
+	Eyes []Move
+
+	// The stones in chains that are caught in a ladder or that the opponent
+	// could start a ladder against, where the Color is the stone's color.
+	Ladders []Move
+}
+
+// Creates an Analysis for the given board size with all statistics zero.
+func NewAnalysis(size, playouts int) *Analysis {
+	a := &Analysis{Size: size, Playouts: playouts}
+	a.Black = make([][]float64, size+1)
+	a.White = make([][]float64, size+1)
+	a.Visits = make([][]int, size+1)
+	a.WinRates = make([][]float64, size+1)
+	for x := range a.Black {
+		a.Black[x] = make([]float64, size+1)
+		a.White[x] = make([]float64, size+1)
+		a.Visits[x] = make([]int, size+1)
+		a.WinRates[x] = make([]float64, size+1)
+	}
+	return a
+}
+
+// Returns the fraction of playouts where neither player owned a point.
+func (a *Analysis) Neutral(x, y int) float64 { return 1 - a.Black[x][y] - a.White[x][y] }
+
+// Search statistics for one move.
+type MoveStats struct {
+	X, Y    int
+	Visits  int
+	WinRate float64 // the fraction of the move's playouts won by the player making it
+
+	// The move, followed by the moves the search expects to be played after it.
+	PrincipalVariation []Vertex
+}
+
+type StoneStatus int
+
+const (
+	Alive StoneStatus = 0
+	Dead  StoneStatus = 1
+	Seki  StoneStatus = 2
+)
+
+func ParseStoneStatus(input string) (s StoneStatus, ok bool) {
+	switch strings.ToLower(input) {
+	case "alive":
+		return Alive, true
+	case "dead":
+		return Dead, true
+	case "seki":
+		return Seki, true
+	}
+	return Alive, false
+}
+
+func (s StoneStatus) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Dead:
+		return "dead"
+	case Seki:
+		return "seki"
+	}
+	panic("invalid stone status")
+}
+
+// The kinds of time limits that a controller can set.
+type TimeSystem int
+
+const (
+	NoTimeLimit     TimeSystem = 0
+	AbsoluteTime    TimeSystem = 1 // main time only
+	JapaneseByoYomi TimeSystem = 2 // main time, then periods of ByoYomiTime per move
+	CanadianByoYomi TimeSystem = 3 // main time, then ByoYomiTime per ByoYomiStones moves
+)
+
+func (t TimeSystem) String() string {
+	switch t {
+	case NoTimeLimit:
+		return "none"
+	case AbsoluteTime:
+		return "absolute"
+	case JapaneseByoYomi:
+		return "byoyomi"
+	case CanadianByoYomi:
+		return "canadian"
+	}
+	panic("invalid time system")
+}
+
+type TimeSettings struct {
+	System         TimeSystem
+	MainTime       time.Duration
+	ByoYomiTime    time.Duration // the length of each byo-yomi period
+	ByoYomiStones  int           // stones to play in each period (Canadian)
+	ByoYomiPeriods int           // the number of periods (Japanese)
+}
+
 // === driver implementation ===
 
 var word_regexp = regexp.MustCompile("[^ ]+")
@@ -170,7 +582,28 @@ func parseCommand(in *bufio.Reader) (cmd string, args []string, err error) {
 			return words[0], words[1:], nil
 		}
 	}
-	return "", nil, errors.New("shouldn't get here")
+}
+
+type command struct {
+	name string
+	args []string
+	err  error // set instead of the name if the command couldn't be read
+}
+
+// Reads commands and sends them to the channel, until there's an error
+// or done is closed.
+func readCommands(in *bufio.Reader, commands chan<- command, done <-chan struct{}) {
+	for {
+		name, args, err := parseCommand(in)
+		select {
+		case commands <- command{name, args, err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
 }
 
 type handler func(request) response
@@ -183,11 +616,36 @@ type request struct {
 type response struct {
 	message string
 	success bool
-}
 
-func success(message string) response { return response{message, true} }
+	// For a command that keeps writing output until the next command arrives.
+	// If set, the message is ignored.
+	stream streamFunc
+}
 
-func error_(message string) response { return response{message, false} }
+// Writes output for a streaming response until stop is closed.
+type streamFunc func(out io.Writer, stop <-chan struct{})
+
+func success(message string) response { return response{message: message, success: true} }
+
+func error_(message string) response { return response{message: message, success: false} }
+
+// Writes a successful response's first line, then runs the stream until the
+// next command arrives. The response ends with a blank line. Returns the
+// command that interrupted the stream.
+func runStream(stream streamFunc, out io.Writer, commands <-chan command) command {
+	fmt.Fprint(out, "= \n")
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		stream(out, stop)
+		close(finished)
+	}()
+	next := <-commands
+	close(stop)
+	<-finished
+	fmt.Fprint(out, "\n")
+	return next
+}
 
 func (r response) String() string {
 	prefix := "="
@@ -209,16 +667,36 @@ func init() {
 			req.robot.ClearBoard()
 			return success("")
 		},
-		"genmove":          handle_genmove,
-		"known_command":    _known,
-		"komi":             handle_komi,
-		"list_commands":    _list,
-		"name":             func(req request) response { return success("gongo") },
-		"play":             handle_play,
-		"protocol_version": func(req request) response { return success("2") },
-		"quit":             func(req request) response { return success("") },
-		"showboard":        handle_showboard,
-		"version":          func(req request) response { return success("") },
+		"final_score":            handle_final_score,
+		"final_status_list":      handle_final_status_list,
+		"fixed_handicap":         handle_fixed_handicap,
+		"genmove":                handle_genmove,
+		"gogui-analyze_commands": handle_gogui_analyze_commands,
+		"gogui-rules":            handle_gogui_rules,
+		"gongo-eyes":             handle_gongo_eyes,
+		"gongo-ladders":          handle_gongo_ladders,
+		"gongo-ownership":        handle_gongo_ownership,
+		"gongo-pv":               handle_gongo_pv,
+		"gongo-visits":           handle_gongo_visits,
+		"gongo-winrates":         handle_gongo_winrates,
+		"kata-analyze":           handle_kata_analyze,
+		"kgs-rules":              handle_kgs_rules,
+		"kgs-time_settings":      handle_kgs_time_settings,
+		"known_command":          _known,
+		"komi":                   handle_komi,
+		"list_commands":          _list,
+		"lz-analyze":             handle_lz_analyze,
+		"name":                   func(req request) response { return success("gongo") },
+		"play":                   handle_play,
+		"place_free_handicap":    handle_place_free_handicap,
+		"protocol_version":       func(req request) response { return success("2") },
+		"quit":                   func(req request) response { return success("") },
+		"set_free_handicap":      handle_set_free_handicap,
+		"showboard":              handle_showboard,
+		"time_left":              handle_time_left,
+		"time_settings":          handle_time_settings,
+		"undo":                   handle_undo,
+		"version":                func(req request) response { return success("") },
 	}
 }
 
@@ -329,6 +807,566 @@ func handle_genmove(req request) (response response) {
 	return
 }
 
+func handle_fixed_handicap(req request) response {
+	if len(req.args) != 1 {
+		return error_("wrong number of arguments")
+	}
+
+	count, err := strconv.Atoi(req.args[0])
+	if err != nil {
+		return error_("syntax error")
+	}
+
+	stones, ok := fixedHandicap(req.robot.GetBoardSize(), count)
+	if !ok {
+		return error_("invalid number of stones")
+	}
+	return placeHandicap(req, stones)
+}
+
+func handle_place_free_handicap(req request) response {
+	if len(req.args) != 1 {
+		return error_("wrong number of arguments")
+	}
+
+	count, err := strconv.Atoi(req.args[0])
+	if err != nil {
+		return error_("syntax error")
+	}
+
+	size := req.robot.GetBoardSize()
+	if count < 2 || count > size*size-1 {
+		return error_("invalid number of stones")
+	}
+	if !isBoardEmpty(req.robot) {
+		return error_("board not empty")
+	}
+
+	placer, ok := req.robot.(GoHandicapRobot)
+	if !ok {
+		// fall back to the fixed layout
+		stones, ok := fixedHandicap(size, count)
+		if !ok {
+			return error_("invalid number of stones")
+		}
+		return placeHandicap(req, stones)
+	}
+	return success(verticesToString(placer.PlaceFreeHandicap(count)))
+}
+
+func handle_set_free_handicap(req request) response {
+	if len(req.args) < 2 {
+		return error_("bad vertex list")
+	}
+
+	size := req.robot.GetBoardSize()
+	stones := make([]Vertex, len(req.args))
+	seen := make(map[Vertex]bool)
+	for i, arg := range req.args {
+		x, y, ok := stringToVertex(arg)
+		if !ok || x == 0 || x > size || y > size || seen[Vertex{x, y}] {
+			return error_("bad vertex list")
+		}
+		stones[i] = Vertex{x, y}
+		seen[stones[i]] = true
+	}
+	if len(stones) > size*size-1 {
+		return error_("bad vertex list")
+	}
+
+	response := placeHandicap(req, stones)
+	if response.success {
+		response.message = "" // set_free_handicap has no output
+	}
+	return response
+}
+
+// Places handicap stones for Black on an empty board. Afterwards, White
+// plays next. Returns the stones' vertices.
+func placeHandicap(req request, stones []Vertex) response {
+	if !isBoardEmpty(req.robot) {
+		return error_("board not empty")
+	}
+	for i, v := range stones {
+		if ok, _ := req.robot.SetStone(Black, v.X, v.Y); !ok {
+			// a failed command leaves the board as it was
+			for _, placed := range stones[:i] {
+				req.robot.SetStone(Empty, placed.X, placed.Y)
+			}
+			return error_("bad vertex list")
+		}
+	}
+	req.robot.SetToPlay(White)
+	return success(verticesToString(stones))
+}
+
+func isBoardEmpty(robot GoRobot) bool {
+	size := robot.GetBoardSize()
+	for y := 1; y <= size; y++ {
+		for x := 1; x <= size; x++ {
+			if robot.GetCell(x, y) != Empty {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func verticesToString(vertices []Vertex) string {
+	words := make([]string, len(vertices))
+	for i, v := range vertices {
+		words[i], _ = vertexToString(v.X, v.Y)
+	}
+	return strings.Join(words, " ")
+}
+
+func handle_time_settings(req request) response {
+	if len(req.args) != 3 {
+		return error_("wrong number of arguments")
+	}
+
+	numbers, ok := parseInts(req.args)
+	if !ok {
+		return error_("syntax error")
+	}
+	mainTime, byoYomiTime, byoYomiStones := numbers[0], numbers[1], numbers[2]
+
+	var settings TimeSettings
+	switch {
+	case byoYomiTime > 0 && byoYomiStones == 0:
+		// the GTP spec's way to say there's no time limit
+		settings.System = NoTimeLimit
+	case byoYomiTime == 0:
+		settings = TimeSettings{System: AbsoluteTime, MainTime: seconds(mainTime)}
+	default:
+		settings = TimeSettings{System: CanadianByoYomi, MainTime: seconds(mainTime),
+			ByoYomiTime: seconds(byoYomiTime), ByoYomiStones: byoYomiStones}
+	}
+	return setTimeSettings(req, settings)
+}
+
+func handle_kgs_time_settings(req request) response {
+	if len(req.args) < 1 {
+		return error_("wrong number of arguments")
+	}
+
+	numbers, ok := parseInts(req.args[1:])
+	if !ok {
+		return error_("syntax error")
+	}
+
+	var settings TimeSettings
+	switch system, argCount := req.args[0], len(numbers); {
+	case system == "none" && argCount == 0:
+		settings.System = NoTimeLimit
+	case system == "absolute" && argCount == 1:
+		settings = TimeSettings{System: AbsoluteTime, MainTime: seconds(numbers[0])}
+	case system == "byoyomi" && argCount == 3:
+		settings = TimeSettings{System: JapaneseByoYomi, MainTime: seconds(numbers[0]),
+			ByoYomiTime: seconds(numbers[1]), ByoYomiPeriods: numbers[2]}
+	case system == "canadian" && argCount == 3:
+		settings = TimeSettings{System: CanadianByoYomi, MainTime: seconds(numbers[0]),
+			ByoYomiTime: seconds(numbers[1]), ByoYomiStones: numbers[2]}
+	default:
+		return error_("syntax error")
+	}
+	return setTimeSettings(req, settings)
+}
+
+func setTimeSettings(req request, settings TimeSettings) response {
+	timed, ok := req.robot.(GoTimedRobot)
+	if !ok {
+		return error_("time settings not supported")
+	}
+	timed.SetTimeSettings(settings)
+	return success("")
+}
+
+func handle_time_left(req request) response {
+	if len(req.args) != 3 {
+		return error_("wrong number of arguments")
+	}
+
+	color, ok := ParseColor(req.args[0])
+	if !ok {
+		return error_("syntax error")
+	}
+
+	numbers, ok := parseInts(req.args[1:])
+	if !ok {
+		return error_("syntax error")
+	}
+
+	timed, ok := req.robot.(GoTimedRobot)
+	if !ok {
+		return error_("time settings not supported")
+	}
+	timed.SetTimeLeft(color, seconds(numbers[0]), numbers[1])
+	return success("")
+}
+
+// The rule sets that can be chosen by name. (The names are the ones KGS uses,
+// plus "tromp-taylor".)
+var namedRules = map[string]Rules{
+	"tromp-taylor": TrompTaylorRules,
+	"chinese":      ChineseRules,
+	"japanese":     JapaneseRules,
+	"aga":          AGARules,
+	"new_zealand":  NewZealandRules,
+}
+
+// The ko rule for each rule set that KGS uses, for robots that only support
+// changing the ko rule.
+var kgsKoRules = map[string]KoRule{
+	"japanese":    SimpleKo,
+	"chinese":     PositionalSuperko,
+	"aga":         SituationalSuperko,
+	"new_zealand": SituationalSuperko,
+}
+
+func handle_kgs_rules(req request) response {
+	if len(req.args) != 1 {
+		return error_("wrong number of arguments")
+	}
+	return setRules(req, req.args[0])
+}
+
+// With no arguments, describes the rules. With one, changes the ko rule
+// (positional, situational, or simple) or chooses a rule set by name.
+func handle_gogui_rules(req request) response {
+	switch len(req.args) {
+	case 0:
+		if robot, ok := req.robot.(GoRulesRobot); ok {
+			return success(robot.GetRules().String())
+		}
+		if robot, ok := req.robot.(GoKoRuleRobot); ok {
+			return success(robot.GetKoRule().String())
+		}
+		return error_("rules not supported")
+	case 1:
+		if rule, ok := ParseKoRule(req.args[0]); ok {
+			return setKoRule(req, rule)
+		}
+		return setRules(req, req.args[0])
+	}
+	return error_("wrong number of arguments")
+}
+
+// Chooses a rule set by name. A robot that can only change the ko rule gets
+// the ko rule of the rule set.
+func setRules(req request, name string) response {
+	name = strings.ToLower(name)
+	if robot, ok := req.robot.(GoRulesRobot); ok {
+		rules, ok := namedRules[name]
+		if !ok {
+			return error_("unknown rules")
+		}
+		robot.SetRules(rules)
+		return success("")
+	}
+	if _, ok := req.robot.(GoKoRuleRobot); ok {
+		rule, ok := kgsKoRules[name]
+		if !ok {
+			return error_("unknown rules")
+		}
+		return setKoRule(req, rule)
+	}
+	return error_("rules not supported")
+}
+
+func setKoRule(req request, rule KoRule) response {
+	robot, ok := req.robot.(GoKoRuleRobot)
+	if !ok {
+		return error_("rules not supported")
+	}
+	robot.SetKoRule(rule)
+	return success("")
+}
+
+func handle_undo(req request) response {
+	if len(req.args) != 0 {
+		return error_("wrong number of arguments")
+	}
+
+	undoer, ok := req.robot.(GoUndoRobot)
+	if !ok || !undoer.Undo() {
+		return error_("cannot undo")
+	}
+	return success("")
+}
+
+func handle_final_score(req request) response {
+	if len(req.args) != 0 {
+		return error_("wrong number of arguments")
+	}
+
+	scorer, ok := req.robot.(GoScorer)
+	if !ok {
+		return error_("cannot score")
+	}
+
+	score := scorer.GetFinalScore()
+	switch {
+	case score > 0:
+		return success(fmt.Sprintf("B+%v", score))
+	case score < 0:
+		return success(fmt.Sprintf("W+%v", -score))
+	}
+	return success("0")
+}
+
+func handle_final_status_list(req request) response {
+	if len(req.args) != 1 {
+		return error_("wrong number of arguments")
+	}
+
+	status, ok := ParseStoneStatus(req.args[0])
+	if !ok {
+		return error_("syntax error")
+	}
+
+	scorer, ok := req.robot.(GoScorer)
+	if !ok {
+		return error_("cannot score")
+	}
+
+	// list each stone on its own line
+	var stones []string
+	size := req.robot.GetBoardSize()
+	for y := size; y >= 1; y-- {
+		for x := 1; x <= size; x++ {
+			if req.robot.GetCell(x, y) != Empty && scorer.GetStoneStatus(x, y) == status {
+				vertex, _ := vertexToString(x, y)
+				stones = append(stones, vertex)
+			}
+		}
+	}
+	return success(strings.Join(stones, "\n"))
+}
+
+// The commands that GoGui shows in its Analyze menu, as type/label/command.
+// A dboard shows a number for each point, an sboard shows a string, and gfx
+// draws markup on the board. [1]
+//
+// [1] http://gogui.sourceforge.net/doc/analyze.html
+var analyzeCommands = []string{
+	"dboard/Ownership/gongo-ownership",
+	"dboard/Win Rates/gongo-winrates",
+	"sboard/Visits/gongo-visits",
+	"gfx/Principal Variation/gongo-pv",
+	"gfx/Eyes/gongo-eyes",
+	"gfx/Ladders/gongo-ladders",
+}
+
+func handle_gogui_analyze_commands(req request) response {
+	if len(req.args) != 0 {
+		return error_("wrong number of arguments")
+	}
+
+	if _, ok := req.robot.(GoAnalyzer); !ok {
+		return success("")
+	}
+	return success(strings.Join(analyzeCommands, "\n"))
+}
+
+// The time between lines of output for lz-analyze and kata-analyze,
+// if the controller doesn't say.
+const defaultAnalyzeInterval = time.Second
+
+// lz-analyze [color] [[interval] centiseconds]
+// Searches in the background, writing the current statistics for each move
+// at every interval until the next command arrives. (This is the Leela Zero
+// extension that Lizzie and Sabaki use.) Win rates are from 0 to 10000.
+func handle_lz_analyze(req request) response {
+	return streamAnalysis(req, func(s MoveStats) string {
+		return fmt.Sprintf("visits %d winrate %d", s.Visits, int(s.WinRate*10000+0.5))
+	})
+}
+
+// kata-analyze [color] [[interval] centiseconds]
+// The same as lz-analyze, except that win rates are from 0 to 1, as KataGo
+// writes them.
+func handle_kata_analyze(req request) response {
+	return streamAnalysis(req, func(s MoveStats) string {
+		return fmt.Sprintf("visits %d winrate %.4f", s.Visits, s.WinRate)
+	})
+}
+
+func streamAnalysis(req request, formatStats func(s MoveStats) string) response {
+	color := req.robot.GetToPlay()
+	interval := defaultAnalyzeInterval
+	args := req.args
+	if len(args) > 0 {
+		if c, ok := ParseColor(args[0]); ok {
+			color = c
+			args = args[1:]
+		}
+	}
+	if len(args) == 2 && args[0] == "interval" {
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return error_("syntax error")
+		}
+		if n > 0 {
+			interval = time.Duration(n) * 10 * time.Millisecond
+		}
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		return error_("syntax error")
+	}
+
+	searcher, ok := req.robot.(GoBackgroundSearcher)
+	if !ok {
+		return error_("analysis not supported")
+	}
+	searcher.StartSearch(color)
+
+	return response{success: true, stream: func(out io.Writer, stop <-chan struct{}) {
+		defer searcher.StopSearch()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if stats := searcher.GetSearchStats(); len(stats) > 0 {
+					fmt.Fprintln(out, formatAnalyzeInfo(stats, formatStats))
+				}
+			}
+		}
+	}}
+}
+
+// Formats one line of lz-analyze output, with an "info" section for each move.
+func formatAnalyzeInfo(stats []MoveStats, formatStats func(s MoveStats) string) string {
+	var infos []string
+	for order, s := range stats {
+		move, _ := vertexToString(s.X, s.Y)
+		pv := make([]string, len(s.PrincipalVariation))
+		for i, v := range s.PrincipalVariation {
+			pv[i], _ = vertexToString(v.X, v.Y)
+		}
+		infos = append(infos, fmt.Sprintf("info move %v %v order %d pv %v",
+			move, formatStats(s), order, strings.Join(pv, " ")))
+	}
+	return strings.Join(infos, " ")
+}
+
+// Runs an analysis and formats the result.
+func analyze(req request, format func(a *Analysis) string) response {
+	if len(req.args) != 0 {
+		return error_("wrong number of arguments")
+	}
+
+	analyzer, ok := req.robot.(GoAnalyzer)
+	if !ok {
+		return error_("analysis not supported")
+	}
+	return success(format(analyzer.Analyze()))
+}
+
+// Shows who owns each point as a number from -1 (White) to 1 (Black).
+func handle_gongo_ownership(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		return formatBoard(a.Size, func(x, y int) string {
+			return fmt.Sprintf("%.2f", a.Black[x][y]-a.White[x][y])
+		})
+	})
+}
+
+// Shows the win rate of each move that was searched, from 0 to 1.
+func handle_gongo_winrates(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		return formatBoard(a.Size, func(x, y int) string {
+			return fmt.Sprintf("%.2f", a.WinRates[x][y])
+		})
+	})
+}
+
+// Shows the number of playouts for each move that was searched.
+func handle_gongo_visits(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		return formatBoard(a.Size, func(x, y int) string {
+			if a.Visits[x][y] == 0 {
+				return `""`
+			}
+			return strconv.Itoa(a.Visits[x][y])
+		})
+	})
+}
+
+// Shows the moves the robot expects to be played next.
+func handle_gongo_pv(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		if len(a.PrincipalVariation) == 0 {
+			return ""
+		}
+		words := []string{"VAR"}
+		for _, m := range a.PrincipalVariation {
+			vertex, ok := vertexToString(m.X, m.Y)
+			if !ok {
+				vertex = "pass"
+			}
+			words = append(words, strings.ToLower(m.Color.String()[:1]), vertex)
+		}
+		return strings.Join(words, " ")
+	})
+}
+
+// Marks each eye with the color of the player who owns it.
+func handle_gongo_eyes(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		return formatColoredPoints(a.Eyes)
+	})
+}
+
+// Marks the stones that are caught in ladders, by color.
+func handle_gongo_ladders(req request) response {
+	return analyze(req, func(a *Analysis) string {
+		return formatColoredPoints(a.Ladders)
+	})
+}
+
+// Formats points as gfx markup, one line for each color that has any.
+func formatColoredPoints(points []Move) string {
+	var lines []string
+	for _, color := range []Color{Black, White} {
+		var vertices []Vertex
+		for _, p := range points {
+			if p.Color == color {
+				vertices = append(vertices, Vertex{p.X, p.Y})
+			}
+		}
+		if len(vertices) > 0 {
+			lines = append(lines, strings.ToUpper(color.String())+" "+verticesToString(vertices))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Formats a value for each point on the board, one row per line,
+// starting from the top.
+func formatBoard(size int, value func(x, y int) string) string {
+	buf := &bytes.Buffer{}
+	for y := size; y >= 1; y-- {
+		for x := 1; x <= size; x++ {
+			if x > 1 {
+				buf.WriteString(" ")
+			}
+			buf.WriteString(value(x, y))
+		}
+		if y > 1 {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String()
+}
+
 func handle_showboard(req request) response {
 	if len(req.args) != 0 {
 		return error_("wrong number of arguments")
@@ -357,6 +1395,21 @@ func handle_showboard(req request) response {
 	return success(buf.String())
 }
 
+// Parses a list of non-negative integers.
+func parseInts(input []string) (result []int, ok bool) {
+	result = make([]int, len(input))
+	for i, arg := range input {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		result[i] = n
+	}
+	return result, true
+}
+
+func seconds(n int) time.Duration { return time.Duration(n) * time.Second }
+
 func stringToVertex(input string) (x, y int, ok bool) {
 	input = strings.ToUpper(input)
 	if len(input) < 2 {
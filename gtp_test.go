@@ -2,9 +2,13 @@ package gongo
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 // === GTP driver tests ===
@@ -13,15 +17,35 @@ func TestListCommands(t *testing.T) {
 	checkCommand(t, nil, "list_commands",
 		`boardsize
 clear_board
+final_score
+final_status_list
+fixed_handicap
 genmove
+gogui-analyze_commands
+gogui-rules
+gongo-eyes
+gongo-ladders
+gongo-ownership
+gongo-pv
+gongo-visits
+gongo-winrates
+kata-analyze
+kgs-rules
+kgs-time_settings
 known_command
 komi
 list_commands
+lz-analyze
 name
+place_free_handicap
 play
 protocol_version
 quit
+set_free_handicap
 showboard
+time_left
+time_settings
+undo
 version`)
 }
 
@@ -125,6 +149,303 @@ func TestShowBoard(t *testing.T) {
 .....`)
 }
 
+func TestTimeSettings(t *testing.T) {
+	checkTimeSettings(t, "time_settings 600 30 5",
+		TimeSettings{System: CanadianByoYomi, MainTime: 600 * time.Second,
+			ByoYomiTime: 30 * time.Second, ByoYomiStones: 5})
+	checkTimeSettings(t, "time_settings 300 0 0",
+		TimeSettings{System: AbsoluteTime, MainTime: 300 * time.Second})
+	checkTimeSettings(t, "time_settings 0 1 0", TimeSettings{System: NoTimeLimit})
+}
+
+func TestKgsTimeSettings(t *testing.T) {
+	checkTimeSettings(t, "kgs-time_settings none", TimeSettings{System: NoTimeLimit})
+	checkTimeSettings(t, "kgs-time_settings absolute 900",
+		TimeSettings{System: AbsoluteTime, MainTime: 900 * time.Second})
+	checkTimeSettings(t, "kgs-time_settings byoyomi 600 30 5",
+		TimeSettings{System: JapaneseByoYomi, MainTime: 600 * time.Second,
+			ByoYomiTime: 30 * time.Second, ByoYomiPeriods: 5})
+	checkTimeSettings(t, "kgs-time_settings canadian 600 300 25",
+		TimeSettings{System: CanadianByoYomi, MainTime: 600 * time.Second,
+			ByoYomiTime: 300 * time.Second, ByoYomiStones: 25})
+	checkRun(t, NewFakeRobot(), "kgs-time_settings fischer 600 10\nquit\n", "? syntax error\n\n= \n\n")
+}
+
+func TestTimeLeft(t *testing.T) {
+	g := NewFakeRobot()
+	checkCommand(t, g, "time_left white 25 3", "")
+	if g.color != White || g.timeLeft != 25*time.Second || g.stones != 3 {
+		t.Errorf("unexpected time left: %v %v %v", g.color, g.timeLeft, g.stones)
+	}
+}
+
+func TestUndoCommand(t *testing.T) {
+	g := NewFakeRobot()
+	checkCommand(t, g, "undo", "")
+	assertEqualsInt(t, 1, g.undoCount, "undo wasn't called")
+
+	g.send_ok = false
+	checkRun(t, g, "undo\nquit\n", "? cannot undo\n\n= \n\n")
+}
+
+func TestFinalScore(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_score = 3.5
+	checkCommand(t, g, "final_score", "B+3.5")
+	g.send_score = -12
+	checkCommand(t, g, "final_score", "W+12")
+	g.send_score = 0
+	checkCommand(t, g, "final_score", "0")
+}
+
+func TestFinalStatusList(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_boardSize = 3
+	g.send_cell[1][3] = White
+	g.send_cell[2][2] = Black
+	g.send_cell[3][1] = Black
+	g.send_status[3][1] = Dead
+	checkCommand(t, g, "final_status_list alive", "A3\nB2")
+	checkCommand(t, g, "final_status_list dead", "C1")
+	checkCommand(t, g, "final_status_list seki", "")
+	checkRun(t, g, "final_status_list asdf\nquit\n", "? syntax error\n\n= \n\n")
+}
+
+func TestOwnership(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_analysis = NewAnalysis(2, 10)
+	g.send_analysis.Black[1][2] = 1
+	g.send_analysis.White[2][1] = 0.75
+	g.send_analysis.Black[2][1] = 0.25
+	checkCommand(t, g, "gongo-ownership", "1.00 0.00\n0.00 -0.50")
+}
+
+func TestAnalyzeCommands(t *testing.T) {
+	g := NewFakeRobot()
+	checkCommand(t, g, "gogui-analyze_commands", strings.Join(analyzeCommands, "\n"))
+
+	a := NewAnalysis(2, 10)
+	a.Visits[1][1] = 7
+	a.WinRates[1][1] = 0.5
+	a.Visits[2][2] = 3
+	a.WinRates[2][2] = 0.25
+	a.PrincipalVariation = []Move{{Black, 1, 1}, {White, 2, 2}, {Black, 0, 0}}
+	a.Eyes = []Move{{White, 1, 2}, {Black, 2, 1}}
+	a.Ladders = []Move{{Black, 1, 1}, {Black, 2, 1}}
+	g.send_analysis = a
+	checkCommand(t, g, "gongo-winrates", "0.00 0.25\n0.50 0.00")
+	checkCommand(t, g, "gongo-visits", "\"\" 3\n7 \"\"")
+	checkCommand(t, g, "gongo-pv", "VAR b A1 w B2 b pass")
+	checkCommand(t, g, "gongo-eyes", "BLACK B1\nWHITE A2")
+	checkCommand(t, g, "gongo-ladders", "BLACK A1 B1")
+
+	a.PrincipalVariation = nil
+	a.Eyes = nil
+	a.Ladders = nil
+	checkCommand(t, g, "gongo-pv", "")
+	checkCommand(t, g, "gongo-eyes", "")
+	checkCommand(t, g, "gongo-ladders", "")
+}
+
+func TestLzAnalyzeStopsAtNextCommand(t *testing.T) {
+	g := NewFakeRobot()
+	g.toPlay = White
+	checkRun(t, g, "lz-analyze 1000\nquit\n", "= \n\n= \n\n")
+	if g.searching {
+		t.Error("search wasn't stopped")
+	}
+	if g.searchColor != White {
+		t.Errorf("expected to search for the player to move but got %v", g.searchColor)
+	}
+
+	checkRun(t, g, "lz-analyze b interval 1000\nkata-analyze w 1000\nquit\n", "= \n\n= \n\n= \n\n")
+	if g.searchColor != White || g.searching {
+		t.Errorf("unexpected search state: %v %v", g.searchColor, g.searching)
+	}
+	for _, args := range []string{"x", "b -1", "b 10 20", "interval"} {
+		checkRun(t, g, "lz-analyze "+args+"\nquit\n", "? syntax error\n\n= \n\n")
+	}
+}
+
+func TestKoRules(t *testing.T) {
+	g := &koRuleOnlyRobot{GoRobot: NewFakeRobot()}
+	checkCommand(t, g, "gogui-rules", "positional superko")
+	for _, c := range []struct {
+		rules    string
+		expected KoRule
+	}{
+		{"japanese", SimpleKo},
+		{"chinese", PositionalSuperko},
+		{"aga", SituationalSuperko},
+		{"new_zealand", SituationalSuperko},
+	} {
+		checkCommand(t, g, "kgs-rules "+c.rules, "")
+		if g.koRule != c.expected {
+			t.Errorf("expected %v for %v rules but got %v", c.expected, c.rules, g.koRule)
+		}
+	}
+	checkCommand(t, g, "gogui-rules", "situational superko")
+	checkCommand(t, g, "gogui-rules simple", "")
+	checkCommand(t, g, "gogui-rules", "simple ko")
+
+	checkRun(t, g, "kgs-rules ing\ngogui-rules triple\nquit\n", "? unknown rules\n\n? unknown rules\n\n= \n\n")
+
+	// a robot that supports all the rules can change just the ko rule
+	f := NewFakeRobot()
+	checkCommand(t, f, "kgs-rules japanese", "")
+	checkCommand(t, f, "gogui-rules situational", "")
+	expected := JapaneseRules
+	expected.KoRule = SituationalSuperko
+	if f.rules != expected {
+		t.Errorf("expected %v but got %v", expected, f.rules)
+	}
+}
+
+func TestRules(t *testing.T) {
+	g := NewFakeRobot()
+	checkCommand(t, g, "gogui-rules", "area scoring, positional superko")
+	for _, c := range []struct {
+		name     string
+		expected Rules
+	}{
+		{"japanese", JapaneseRules},
+		{"Chinese", ChineseRules},
+		{"aga", AGARules},
+		{"new_zealand", NewZealandRules},
+	} {
+		checkCommand(t, g, "kgs-rules "+c.name, "")
+		if g.rules != c.expected {
+			t.Errorf("expected %v for %v but got %v", c.expected, c.name, g.rules)
+		}
+	}
+	checkCommand(t, g, "gogui-rules", "area scoring, situational superko, suicide allowed")
+	checkCommand(t, g, "gogui-rules aga", "")
+	checkCommand(t, g, "gogui-rules", "area scoring, situational superko, handicap compensation N-1")
+	checkCommand(t, g, "gogui-rules tromp-taylor", "")
+	checkCommand(t, g, "gogui-rules", "area scoring, positional superko, suicide allowed")
+
+	checkRun(t, g, "kgs-rules ing\ngogui-rules a b\nquit\n", "? unknown rules\n\n? wrong number of arguments\n\n= \n\n")
+}
+
+func TestRunStopsPondering(t *testing.T) {
+	g := NewFakeRobot()
+	g.searching = true
+	checkRun(t, g, "name\nquit\n", "= gongo\n\n= \n\n")
+	if g.searching {
+		t.Error("expected the background search to be stopped")
+	}
+}
+
+func TestLzAnalyzeStreamsOutput(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_stats = []MoveStats{{X: 4, Y: 4, Visits: 10, WinRate: 0.5,
+		PrincipalVariation: []Vertex{{4, 4}, {3, 3}}}}
+
+	in, input := io.Pipe()
+	out := new(syncBuffer)
+	finished := make(chan error)
+	go func() { finished <- Run(g, in, out) }()
+
+	fmt.Fprint(input, "lz-analyze 1\n")
+	for !strings.Contains(out.String(), "info") {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Fprint(input, "quit\n")
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(out.String(), "\n")
+	if lines[0] != "= " || lines[1] != "info move D4 visits 10 winrate 5000 order 0 pv D4 C3" {
+		t.Errorf("unexpected output: %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "order 0 pv D4 C3\n\n= \n\n") {
+		t.Errorf("unexpected end of output: %q", out.String())
+	}
+}
+
+func TestFormatAnalyzeInfo(t *testing.T) {
+	stats := []MoveStats{
+		{X: 3, Y: 3, Visits: 20, WinRate: 0.75, PrincipalVariation: []Vertex{{3, 3}}},
+		{X: 1, Y: 1, Visits: 5, WinRate: 0.2, PrincipalVariation: []Vertex{{1, 1}, {3, 3}}},
+	}
+	expected := "info move C3 visits 20 winrate 0.7500 order 0 pv C3 " +
+		"info move A1 visits 5 winrate 0.2000 order 1 pv A1 C3"
+	actual := formatAnalyzeInfo(stats, func(s MoveStats) string {
+		return fmt.Sprintf("visits %d winrate %.4f", s.Visits, s.WinRate)
+	})
+	if actual != expected {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, actual)
+	}
+}
+
+func TestFixedHandicap(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_boardSize = 19
+	checkCommand(t, g, "fixed_handicap 3", "D4 Q16 D16")
+	expected := []Move{{Black, 4, 4}, {Black, 16, 16}, {Black, 4, 16}}
+	if fmt.Sprint(g.setup) != fmt.Sprint(expected) {
+		t.Errorf("expected %v but got %v", expected, g.setup)
+	}
+	if g.toPlay != White {
+		t.Errorf("expected White to play but got %v", g.toPlay)
+	}
+	checkRun(t, g, "fixed_handicap 10\nquit\n", "? invalid number of stones\n\n= \n\n")
+
+	g.send_cell[4][4] = Black
+	checkRun(t, g, "fixed_handicap 2\nquit\n", "? board not empty\n\n= \n\n")
+}
+
+func TestPlaceFreeHandicapWithoutRobotSupport(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_boardSize = 9
+	checkCommand(t, g, "place_free_handicap 2", "C3 G7")
+	checkRun(t, g, "place_free_handicap 1\nquit\n", "? invalid number of stones\n\n= \n\n")
+}
+
+func TestSetFreeHandicap(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_boardSize = 9
+	checkCommand(t, g, "set_free_handicap A1 J9 E5", "")
+	expected := []Move{{Black, 1, 1}, {Black, 9, 9}, {Black, 5, 5}}
+	if fmt.Sprint(g.setup) != fmt.Sprint(expected) {
+		t.Errorf("expected %v but got %v", expected, g.setup)
+	}
+	for _, args := range []string{"A1", "A1 A1", "A1 pass", "A1 K10", "A1 xyz"} {
+		checkRun(t, g, "set_free_handicap "+args+"\nquit\n", "? bad vertex list\n\n= \n\n")
+	}
+}
+
+func TestSetFreeHandicapLeavesBoardUnchangedOnError(t *testing.T) {
+	g := NewFakeRobot()
+	g.send_boardSize = 9
+	g.send_badStone = Vertex{5, 5}
+	checkRun(t, g, "set_free_handicap A1 J9 E5\nquit\n", "? bad vertex list\n\n= \n\n")
+	expected := []Move{{Black, 1, 1}, {Black, 9, 9}, {Empty, 1, 1}, {Empty, 9, 9}}
+	if fmt.Sprint(g.setup) != fmt.Sprint(expected) {
+		t.Errorf("expected %v but got %v", expected, g.setup)
+	}
+	if g.toPlay != Empty {
+		t.Errorf("expected the player to move not to change but got %v", g.toPlay)
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	RegisterCommand("echo-size", func(robot GoRobot, args []string) (string, bool) {
+		if len(args) != 0 {
+			return "wrong number of arguments", false
+		}
+		return fmt.Sprint(robot.GetBoardSize()), true
+	})
+	defer delete(handlers, "echo-size")
+
+	g := NewFakeRobot()
+	g.send_boardSize = 9
+	checkCommand(t, g, "echo-size", "9")
+	checkCommand(t, g, "known_command echo-size", "true")
+	checkRun(t, g, "echo-size 1\nquit\n", "? wrong number of arguments\n\n= \n\n")
+}
+
 func TestParseColor(t *testing.T) {
 	checkColor(t, "b", Black)
 	checkColor(t, "w", White)
@@ -157,6 +478,20 @@ type fake_robot struct {
 	send_ok         bool
 	send_boardSize  int
 	send_cell       [MaxBoardSize][MaxBoardSize]Color
+	timeSettings    TimeSettings
+	timeLeft        time.Duration
+	stones          int
+	undoCount       int
+	send_score      float64
+	send_status     [MaxBoardSize][MaxBoardSize]StoneStatus
+	setup           []Move
+	toPlay          Color
+	send_analysis   *Analysis
+	send_stats      []MoveStats
+	searching       bool
+	searchColor     Color
+	rules           Rules
+	send_badStone   Vertex // SetStone fails here
 }
 
 func NewFakeRobot() *fake_robot { return &fake_robot{send_ok: true} }
@@ -177,11 +512,69 @@ func (r *fake_robot) Play(color Color, x, y int) (ok bool, message string) {
 	return r.send_ok, ""
 }
 
+func (r *fake_robot) SetStone(color Color, x, y int) (ok bool, message string) {
+	if (Vertex{x, y}) == r.send_badStone {
+		return false, "no liberties"
+	}
+	r.setup = append(r.setup, Move{color, x, y})
+	return r.send_ok, ""
+}
+
+func (r *fake_robot) GetToPlay() Color { return r.toPlay }
+
+func (r *fake_robot) SetToPlay(color Color) { r.toPlay = color }
+
 func (r *fake_robot) GenMove(color Color) (x, y int, result MoveResult) {
 	r.color = color
 	return r.send_x, r.send_y, r.send_moveResult
 }
 
+func (r *fake_robot) SetTimeSettings(settings TimeSettings) { r.timeSettings = settings }
+
+func (r *fake_robot) SetTimeLeft(color Color, timeLeft time.Duration, stones int) {
+	r.color = color
+	r.timeLeft = timeLeft
+	r.stones = stones
+}
+
+func (r *fake_robot) Undo() bool {
+	r.undoCount++
+	return r.send_ok
+}
+
+func (r *fake_robot) GetRules() Rules { return r.rules }
+
+func (r *fake_robot) SetRules(rules Rules) { r.rules = rules }
+
+func (r *fake_robot) GetKoRule() KoRule { return r.rules.KoRule }
+
+func (r *fake_robot) SetKoRule(rule KoRule) { r.rules.KoRule = rule }
+
+// A robot that can change the ko rule but not the other rules.
+type koRuleOnlyRobot struct {
+	GoRobot
+	koRule KoRule
+}
+
+func (r *koRuleOnlyRobot) GetKoRule() KoRule { return r.koRule }
+
+func (r *koRuleOnlyRobot) SetKoRule(rule KoRule) { r.koRule = rule }
+
+func (r *fake_robot) GetFinalScore() float64 { return r.send_score }
+
+func (r *fake_robot) GetStoneStatus(x, y int) StoneStatus { return r.send_status[x][y] }
+
+func (r *fake_robot) Analyze() *Analysis { return r.send_analysis }
+
+func (r *fake_robot) StartSearch(color Color) {
+	r.searching = true
+	r.searchColor = color
+}
+
+func (r *fake_robot) GetSearchStats() []MoveStats { return r.send_stats }
+
+func (r *fake_robot) StopSearch() { r.searching = false }
+
 func (r *fake_robot) GetBoardSize() int { return r.send_boardSize }
 
 func (r *fake_robot) GetCell(x, y int) Color { return r.send_cell[x][y] }
@@ -197,6 +590,14 @@ func checkGenmove(t *testing.T, x, y int, expected string) {
 	}
 }
 
+func checkTimeSettings(t *testing.T, command string, expected TimeSettings) {
+	g := NewFakeRobot()
+	checkCommand(t, g, command, "")
+	if g.timeSettings != expected {
+		t.Errorf("for %v, expected %v but got %v", command, expected, g.timeSettings)
+	}
+}
+
 func checkColor(t *testing.T, input string, expected Color) {
 	actual, ok := ParseColor(input)
 	if !ok {
@@ -243,6 +644,24 @@ var (
 	newlines = regexp.MustCompile("\n")
 )
 
+// A buffer that can be written by one goroutine while another reads it.
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
 func format(in string) string {
 	result := newlines.ReplaceAllString(in, "^\n")
 	if !strings.HasSuffix(in, "\n") {
@@ -0,0 +1,89 @@
+package gongo
+
+// === Handicap stones ===
+
+// The GTP spec defines where the fixed handicap stones go. The corner stones
+// are on the fourth line on boards of 13x13 and up, and on the third line on
+// smaller boards. Boards with an odd size of at least 9x9 can have up to nine
+// stones, using the middle lines; otherwise, only the four corners are used.
+// There's no fixed handicap for boards smaller than 7x7.
+
+// Returns the largest number of fixed handicap stones for a board size.
+func maxFixedHandicap(size int) int {
+	switch {
+	case size < 7:
+		return 0
+	case size%2 == 1 && size >= 9:
+		return 9
+	}
+	return 4
+}
+
+// Returns the points for a fixed handicap, in the order the GTP spec lists
+// them, or false if the board size doesn't support that many stones.
+func fixedHandicap(size, count int) ([]Vertex, bool) {
+	if count < 2 || count > maxFixedHandicap(size) {
+		return nil, false
+	}
+	low := 3
+	if size >= 13 {
+		low = 4
+	}
+	high := size + 1 - low
+	mid := (size + 1) / 2
+
+	// The corners come first; the center stone goes last when count is odd.
+	points := []Vertex{{low, low}, {high, high}, {low, high}, {high, low}}
+	switch {
+	case count >= 8:
+		points = append(points, Vertex{low, mid}, Vertex{high, mid}, Vertex{mid, low}, Vertex{mid, high})
+	case count >= 6:
+		points = append(points, Vertex{low, mid}, Vertex{high, mid})
+	}
+	if count < 4 {
+		points = points[:count]
+	}
+	if count%2 == 1 && count >= 5 {
+		points = append(points, Vertex{mid, mid})
+	}
+	return points, true
+}
+
+// Places handicap stones on an empty board. As many stones as possible use
+// the fixed layout; the rest are chosen by searching, as if Black played
+// several moves in a row.
+func (r *robot) PlaceFreeHandicap(count int) []Vertex {
+	r.StopSearch()
+	fixedCount := count
+	if max := maxFixedHandicap(r.board.size); fixedCount > max {
+		fixedCount = max
+	}
+	stones, _ := fixedHandicap(r.board.size, fixedCount)
+	for _, v := range stones {
+		r.SetStone(Black, v.X, v.Y)
+	}
+
+	for len(stones) < count {
+		r.SetToPlay(Black)
+		r.root = newRoot(r.board, r.randomness, func(move pt) bool {
+			return r.checkLegalMove(move) == played
+		})
+		limit := searchLimit{maxPlayouts: r.sampleCount}
+		if limit.maxPlayouts == 0 {
+			limit.maxPlayouts = defaultSampleCount
+		}
+		r.search(limit)
+
+		best := r.root.bestChild()
+		if best == nil {
+			break // nowhere left to play
+		}
+		x, y := r.board.getCoords(best.move)
+		if ok, _ := r.SetStone(Black, x, y); !ok {
+			break
+		}
+		stones = append(stones, Vertex{x, y})
+	}
+	r.SetToPlay(White)
+	return stones
+}
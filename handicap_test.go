@@ -0,0 +1,59 @@
+package gongo
+
+import (
+	"testing"
+)
+
+func TestFixedHandicapLayouts(t *testing.T) {
+	checkFixedHandicap(t, 19, 2, "D4 Q16")
+	checkFixedHandicap(t, 19, 5, "D4 Q16 D16 Q4 K10")
+	checkFixedHandicap(t, 19, 6, "D4 Q16 D16 Q4 D10 Q10")
+	checkFixedHandicap(t, 19, 7, "D4 Q16 D16 Q4 D10 Q10 K10")
+	checkFixedHandicap(t, 19, 9, "D4 Q16 D16 Q4 D10 Q10 K4 K16 K10")
+	checkFixedHandicap(t, 13, 4, "D4 K10 D10 K4")
+	checkFixedHandicap(t, 9, 3, "C3 G7 C7")
+	checkFixedHandicap(t, 7, 4, "C3 E5 C5 E3")
+
+	for _, c := range []struct{ size, count int }{{19, 1}, {19, 10}, {10, 5}, {7, 5}, {6, 2}} {
+		if _, ok := fixedHandicap(c.size, c.count); ok {
+			t.Errorf("expected no fixed handicap of %v stones on %vx%v", c.count, c.size, c.size)
+		}
+	}
+}
+
+func checkFixedHandicap(t *testing.T, size, count int, expected string) {
+	stones, ok := fixedHandicap(size, count)
+	if !ok {
+		t.Errorf("no fixed handicap of %v stones on %vx%v", count, size, size)
+		return
+	}
+	if actual := verticesToString(stones); actual != expected {
+		t.Errorf("%vx%v, %v stones: expected %v but got %v", size, size, count, expected, actual)
+	}
+}
+
+func TestPlaceFreeHandicap(t *testing.T) {
+	r := NewRobot(9)
+	stones := r.(GoHandicapRobot).PlaceFreeHandicap(3)
+	if actual := verticesToString(stones); actual != "C3 G7 C7" {
+		t.Errorf("expected the fixed layout but got %v", actual)
+	}
+	checkWhiteToPlay(t, r)
+
+	// more stones than the fixed layout has
+	r = NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100})
+	stones = r.(GoHandicapRobot).PlaceFreeHandicap(3)
+	assertEqualsInt(t, 3, len(stones), "wrong number of stones")
+	for _, v := range stones {
+		if r.GetCell(v.X, v.Y) != Black {
+			t.Errorf("no black stone at %v", v)
+		}
+	}
+	checkWhiteToPlay(t, r)
+}
+
+func checkWhiteToPlay(t *testing.T, r GoRobot) {
+	if !r.(*robot).board.isMyTurn(White) {
+		t.Error("expected White to play after the handicap stones")
+	}
+}
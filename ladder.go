@@ -0,0 +1,170 @@
+package gongo
+
+// === Ladders ===
+
+// A ladder is a chain in atari that runs along a zigzag path: each time it
+// extends, it has only two liberties, and the attacker puts it back in atari.
+// Unless the path runs into one of the defender's stones (a ladder breaker)
+// or the defender can capture an attacking stone, the chain is captured at
+// the edge of the board. Running out a dead ladder is a classic blunder that
+// makes the loss worse.
+//
+// The reader plays out the ladder on the board and takes the moves back
+// afterwards, so the board is unchanged when it returns.
+
+// Ladders longer than this are assumed to escape. (A ladder can't be longer
+// than twice the board size, so this only matters for odd shapes.)
+const maxLadderDepth = 2 * maxBoardSize
+
+// Returns true if the chain containing the given stone is in atari and
+// would be captured in a ladder if it ran, with the defender to move.
+func (b *board) isCaughtInLadder(target pt) bool {
+	toPlay := b.toPlay
+	b.toPlay = b.cells[target]
+	caught := b.ladderCaptures(target, 0)
+	b.toPlay = toPlay
+	return caught
+}
+
+// Returns true if the chain containing the given stone has two liberties
+// and the opponent can capture it in a ladder, by moving first.
+func (b *board) canBeLaddered(target pt) bool {
+	if libertyCount, _ := b.countLiberties(target, 3); libertyCount != 2 {
+		return false
+	}
+	liberties := [2]pt{b.liberties[0], b.liberties[1]}
+
+	toPlay := b.toPlay
+	b.toPlay = b.cells[target] ^ 3
+	caught := b.attackLadder(target, liberties, 0)
+	b.toPlay = toPlay
+	return caught
+}
+
+// Returns true if the given move, by the player to move, extends a chain
+// in atari that would then be captured in a ladder.
+func (b *board) runsIntoLadder(move pt) bool {
+	if move == PASS {
+		return false
+	}
+	friendlyStone := b.toPlay
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := move + b.dirOffset[dir]
+		if b.cells[neighborPt] != friendlyStone {
+			continue
+		}
+		libertyCount, _ := b.countLiberties(neighborPt, 2)
+		if libertyCount == 1 && b.liberties[0] == move && b.ladderCaptures(neighborPt, 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// The defender's turn: the chain containing target is in atari. Returns true
+// if it's captured whether it extends or not.
+func (b *board) ladderCaptures(target pt, depth int) bool {
+	libertyCount, _ := b.countLiberties(target, 2)
+	if libertyCount != 1 {
+		return libertyCount == 0
+	}
+	if depth > maxLadderDepth {
+		return false
+	}
+	escape := b.liberties[0]
+	chainCount := b.listChain(target)
+
+	// Capturing an attacking stone usually gets the chain out. (To keep
+	// this fast, only the first few attacking stones are checked.)
+	var attackers [16]pt
+	attackerCount := 0
+	enemyStone := b.cells[target] ^ 3
+	for i := 0; i < chainCount && attackerCount < len(attackers); i++ {
+		for dir := 0; dir < 4 && attackerCount < len(attackers); dir++ {
+			neighborPt := b.chainPoints[i] + b.dirOffset[dir]
+			if b.cells[neighborPt] == enemyStone {
+				attackers[attackerCount] = neighborPt
+				attackerCount++
+			}
+		}
+	}
+	for _, attacker := range attackers[:attackerCount] {
+		if b.libertyCount(attacker) == 1 {
+			return false
+		}
+	}
+
+	if result, _ := b.makeMove(escape); result != played {
+		return true
+	}
+	defer b.undo()
+
+	libertyCount, _ = b.countLiberties(escape, 3)
+	switch libertyCount {
+	case 0, 1:
+		return true
+	case 2:
+		return b.attackLadder(escape, [2]pt{b.liberties[0], b.liberties[1]}, depth)
+	}
+	return false
+}
+
+// The attacker's turn: the chain containing target has the given two
+// liberties. Returns true if putting it in atari on either one works.
+func (b *board) attackLadder(target pt, liberties [2]pt, depth int) bool {
+	for _, atari := range liberties {
+		if result, _ := b.makeMove(atari); result != played {
+			continue
+		}
+		// If the attacking stone can be captured right away, it doesn't work.
+		caught := false
+		if b.libertyCount(atari) > 1 {
+			caught = b.ladderCaptures(target, depth+1)
+		}
+		b.undo()
+		if caught {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns each stone in a chain that's caught in a ladder, or that the
+// opponent could capture in a ladder by moving first. The Color is the
+// stone's color.
+func (r *robot) findLadders() []Move {
+	b := r.scratchBoard
+	b.copyFrom(r.board)
+
+	// Each chain is read once, and the result is saved for all its stones.
+	// (Reading may choose a different head for a chain, so the stones are
+	// marked instead of the head.)
+	const (
+		unread = iota
+		escapes
+		caught
+	)
+	status := make([]byte, len(b.cells))
+	for _, p := range b.allPoints {
+		if stone := b.cells[p]; (stone != BLACK && stone != WHITE) || status[p] != unread {
+			continue
+		}
+		result := byte(escapes)
+		if b.isCaughtInLadder(p) || b.canBeLaddered(p) {
+			result = caught
+		}
+		chainCount := b.listChain(p)
+		for _, stonePt := range b.chainPoints[:chainCount] {
+			status[stonePt] = result
+		}
+	}
+
+	var stones []Move
+	for _, p := range b.allPoints {
+		if status[p] == caught {
+			x, y := b.getCoords(p)
+			stones = append(stones, Move{b.cells[p].toColor(), x, y})
+		}
+	}
+	return stones
+}
@@ -0,0 +1,153 @@
+package gongo
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A black stone at C4 that White can chase down and to the left.
+const ladderBoard = `
+.......
+.......
+..O....
+.O@....
+...O...
+.......
+.......`
+
+// The same ladder, with a ladder breaker at B2.
+const brokenLadderBoard = `
+.......
+.......
+..O....
+.O@....
+...O...
+.@.....
+.......`
+
+func TestCaughtInLadder(t *testing.T) {
+	b := makeBoard(ladderBoard)
+	checkCanBeLaddered(t, &b, 3, 4, true)
+	b.Play(White, 4, 4)
+	checkCaughtInLadder(t, &b, 3, 4, true)
+	checkCanBeLaddered(t, &b, 4, 4, false)
+
+	b = makeBoard(brokenLadderBoard)
+	b.Play(White, 4, 4)
+	checkCaughtInLadder(t, &b, 3, 4, false)
+}
+
+func TestLadderEscapesByCapturing(t *testing.T) {
+	// C4 can't run, but it can capture C5.
+	b := makeBoard(`
+.......
+.......
+.@O@...
+.O@O...
+.O.O...
+.......
+.......`)
+	checkCaughtInLadder(t, &b, 3, 4, false)
+
+	b = makeBoard(`
+.......
+..O....
+.@O@...
+.O@O...
+.O.O...
+.......
+.......`)
+	checkCaughtInLadder(t, &b, 3, 4, true)
+}
+
+func TestRunsIntoLadder(t *testing.T) {
+	b := makeBoard(ladderBoard)
+	b.Play(White, 4, 4)
+	if !b.runsIntoLadder(b.makePt(3, 3)) {
+		t.Error("expected C3 to run into a ladder")
+	}
+	if b.runsIntoLadder(b.makePt(6, 6)) {
+		t.Error("expected F6 not to run into a ladder")
+	}
+	if b.runsIntoLadder(PASS) {
+		t.Error("expected a pass not to run into a ladder")
+	}
+}
+
+func TestAtariDoesNotRunLadder(t *testing.T) {
+	b := makeBoard(ladderBoard)
+	b.Play(White, 4, 4)
+	moveCount := b.moveCount
+	if b.playAtariMove() || b.moveCount != moveCount {
+		t.Error("expected no move when the ladder doesn't work")
+	}
+
+	b = makeBoard(brokenLadderBoard)
+	b.Play(White, 4, 4)
+	checkAtariMove(t, &b, `
+.......
+.......
+..O....
+.O@O...
+..@O...
+.@.....
+.......`)
+}
+
+func TestGenMoveDoesNotRunLadder(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 7, SampleCount: 200}).(*robot)
+	setUpBoard(r, ladderBoard)
+	r.Play(White, 4, 4)
+	r.prepareRoot()
+	for _, child := range r.root.children {
+		if child.move == r.board.makePt(3, 3) {
+			t.Error("expected C3 not to be considered")
+		}
+	}
+}
+
+func TestFindLadders(t *testing.T) {
+	r := NewRobot(7).(*robot)
+	setUpBoard(r, ladderBoard)
+	expected := []Move{{Black, 3, 4}}
+	if actual := r.findLadders(); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("expected ladders %v but got %v", expected, actual)
+	}
+
+	// every stone in the chain is reported
+	setUpBoard(r, `
+.......
+.......
+..OO...
+.O@@...
+..O....
+.......
+.......`)
+	expected = []Move{{Black, 3, 4}, {Black, 4, 4}}
+	if actual := r.findLadders(); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("expected ladders %v but got %v", expected, actual)
+	}
+}
+
+func checkCaughtInLadder(t *testing.T, b *board, x, y int, expected bool) {
+	before := copyBoard(b)
+	if actual := b.isCaughtInLadder(b.makePt(x, y)); actual != expected {
+		t.Errorf("expected caught in ladder at %v,%v to be %v", x, y, expected)
+	}
+	checkSameBoard(t, before, b)
+}
+
+func checkCanBeLaddered(t *testing.T, b *board, x, y int, expected bool) {
+	before := copyBoard(b)
+	if actual := b.canBeLaddered(b.makePt(x, y)); actual != expected {
+		t.Errorf("expected can be laddered at %v,%v to be %v", x, y, expected)
+	}
+	checkSameBoard(t, before, b)
+}
+
+func copyBoard(b *board) *board {
+	result := new(board)
+	result.clearBoard(b.size)
+	result.copyFrom(b)
+	return result
+}
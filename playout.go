@@ -0,0 +1,429 @@
+package gongo
+
+// === Playout policies ===
+
+// A playout policy chooses the moves in the random games that are played
+// to estimate who is winning. By default, a board uses the uniform policy in
+// playRandomGame, which picks any empty point that doesn't fill an eye and is
+// as fast as possible. Heavier policies play more sensible moves, which makes
+// each playout slower but its result more meaningful.
+
+type playoutPolicy interface {
+	// Makes the next move in a playout for the player to move. Returns
+	// played, or passed if the policy couldn't find a move.
+	playMove(b *board, rand Randomness) moveResult
+}
+
+// Plays a game to the end using the board's policy.
+func (b *board) playGameWithPolicy(rand Randomness) {
+	maxMoves := len(b.allPoints) * 3
+	passes := 0
+	for b.moveCount < maxMoves && passes < 2 {
+		if b.policy.playMove(b, rand) == passed {
+			passes++
+		} else {
+			passes = 0
+		}
+	}
+}
+
+// Plays a random move that doesn't fill in an eye, or passes if there isn't one.
+func (b *board) playRandomMove(rand Randomness) moveResult {
+	count := 0
+	for _, p := range b.allPoints {
+		if b.cells[p] == EMPTY {
+			b.candidates[count] = p
+			count++
+		}
+	}
+	if b.tryCandidates(count, rand) {
+		return played
+	}
+	b.makeMove(PASS)
+	return passed
+}
+
+// Tries to play the first count moves in b.candidates, in random order,
+// skipping moves that would fill an eye or put a chain in atari. Returns
+// true if one was played.
+func (b *board) tryCandidates(count int, rand Randomness) bool {
+	for count > 0 {
+		i := rand.Intn(count)
+		p := b.candidates[i]
+		if !b.wouldFillEye(p) && !b.isSelfAtari(p) {
+			if result, _ := b.makeMove(p); result == played {
+				return true
+			}
+		}
+		count--
+		b.candidates[i] = b.candidates[count]
+	}
+	return false
+}
+
+// The policy for HeavyPlayouts. It answers the last move locally: first
+// by capturing or escaping if there's a stone in atari, then where one of
+// the points next to it matches a 3x3 pattern. Otherwise it plays randomly.
+// (This is the scheme from MoGo. [1])
+//
+// [1] Gelly et al., "Modification of UCT with Patterns in Monte-Carlo Go" (2006)
+type heavyPolicy struct{}
+
+func (heavyPolicy) playMove(b *board, rand Randomness) moveResult {
+	if b.playAtariMove() || b.playPatternMove(rand) {
+		return played
+	}
+	return b.playRandomMove(rand)
+}
+
+// Captures the stones of the last move if they're in atari. Otherwise,
+// tries to save our own stones next to the last move that are in atari.
+// Returns false if there's nothing to do.
+func (b *board) playAtariMove() bool {
+	if b.moveCount == 0 {
+		return false
+	}
+	last := b.moves[b.moveCount-1] & MOVE_TO_PT_MASK
+	friendlyStone := b.toPlay
+	if last == PASS || b.cells[last] != friendlyStone^3 {
+		return false
+	}
+
+	if libertyCount, _ := b.countLiberties(last, 2); libertyCount == 1 {
+		if result, _ := b.makeMove(b.liberties[0]); result == played {
+			return true
+		}
+	}
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := last + b.dirOffset[dir]
+		if b.cells[neighborPt] == friendlyStone && b.saveChain(neighborPt) {
+			return true
+		}
+	}
+	return false
+}
+
+// If the chain containing the given stone is in atari, tries to save it by
+// capturing an enemy chain next to it that's also in atari, or else by
+// extending. (Extending doesn't count if the chain would still be in atari
+// or would be caught in a ladder.) Returns true if a move was played.
+func (b *board) saveChain(target pt) bool {
+	libertyCount, _ := b.countLiberties(target, 2)
+	if libertyCount != 1 {
+		return false
+	}
+	escape := b.liberties[0]
+	chain := b.savedChain[:b.listChain(target)]
+	copy(chain, b.chainPoints)
+
+	enemyStone := b.toPlay ^ 3
+	for _, p := range chain {
+		for dir := 0; dir < 4; dir++ {
+			neighborPt := p + b.dirOffset[dir]
+			if b.cells[neighborPt] != enemyStone {
+				continue
+			}
+			if libertyCount, _ := b.countLiberties(neighborPt, 2); libertyCount == 1 {
+				if result, _ := b.makeMove(b.liberties[0]); result == played {
+					return true
+				}
+			}
+		}
+	}
+
+	if result, _ := b.makeMove(escape); result != played {
+		return false
+	}
+	libertyCount, _ = b.countLiberties(escape, 3)
+	if libertyCount < 2 || (libertyCount == 2 && b.attackLadder(escape, [2]pt{b.liberties[0], b.liberties[1]}, 0)) {
+		b.undo()
+		return false
+	}
+	return true
+}
+
+// Returns true if the given move would put its own chain of two or more
+// stones in atari (or commit suicide). Single stones don't count, since
+// throw-ins are often good moves, and neither do sacrifices that fill an
+// enemy eye space in a shape that can only make one eye (a nakade).
+func (b *board) isSelfAtari(move pt) bool {
+	if move == PASS || b.neighborCounts[move] <= 2 {
+		return false // at least two liberties
+	}
+
+	// Without captures, the new chain's liberties are the empty points next
+	// to the move and the other liberties of the friendly chains it joins.
+	// That's usually enough to tell without playing the move.
+	var liberties [2]pt
+	libertyCount := 0
+	chainCount := 1
+	var joined [4]pt
+	joinedCount := 0
+	noteLiberty := func(p pt) {
+		if p != move && !ptIn(p, liberties[:libertyCount]) && libertyCount < len(liberties) {
+			liberties[libertyCount] = p
+			libertyCount++
+		}
+	}
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := move + b.dirOffset[dir]
+		switch b.cells[neighborPt] {
+		case EMPTY:
+			noteLiberty(neighborPt)
+		case b.toPlay:
+			head := b.chainHead[neighborPt]
+			if ptIn(head, joined[:joinedCount]) {
+				continue
+			}
+			joined[joinedCount] = head
+			joinedCount++
+			chainCount += b.chainSize[head]
+			count, _ := b.countLiberties(head, 3)
+			for _, p := range b.liberties[:count] {
+				noteLiberty(p)
+			}
+		case b.toPlay ^ 3:
+			if b.isOnlyLiberty(neighborPt, move) {
+				libertyCount = -1 // it captures
+			}
+		}
+		if libertyCount < 0 {
+			break
+		}
+	}
+	switch {
+	case libertyCount >= 2:
+		return false
+	case libertyCount == 1 && chainCount == 1:
+		return false // a single stone
+	}
+
+	// It captures, is suicide, or might be nakade; play it to find out.
+	if result, _ := b.makeMove(move); result != played {
+		return false
+	}
+	selfAtari := false
+	if b.moves[b.moveCount-1]&SUICIDE_MOVE != 0 {
+		selfAtari = true
+	} else if libertyCount, chainCount := b.countLiberties(move, 2); libertyCount == 1 && chainCount > 1 {
+		selfAtari = !b.isNakade(move)
+	}
+	b.undo()
+	return selfAtari
+}
+
+// Nakade shapes have at most this many points.
+const maxNakadeSize = 6
+
+// Returns true if the chain containing the given stone and its last liberty
+// in b.liberties fill a space enclosed by enemy stones that can only make
+// one eye: any three points, the square and pyramid fours, the bulky and
+// crossed fives, and the rabbity six. Capturing the chain leaves the enemy with
+// this shape, which is dead if the player can play its vital point.
+func (b *board) isNakade(target pt) bool {
+	if b.chainSize[b.chainHead[target]] >= maxNakadeSize {
+		return false
+	}
+	chainCount := b.listChain(target)
+	var region [maxNakadeSize]pt
+	copy(region[:], b.chainPoints[:chainCount])
+	region[chainCount] = b.liberties[0]
+	size := chainCount + 1
+
+	enemyStone := b.cells[region[0]] ^ 3
+	maxNeighbors := 0
+	neighborSum := 0 // each adjacent pair of points is counted twice
+	for _, p := range region[:size] {
+		neighbors := 0
+		for dir := 0; dir < 4; dir++ {
+			neighborPt := p + b.dirOffset[dir]
+			if ptIn(neighborPt, region[:size]) {
+				neighbors++
+			} else if b.cells[neighborPt] != enemyStone && b.cells[neighborPt] != EDGE {
+				return false
+			}
+		}
+		neighborSum += neighbors
+		if neighbors > maxNeighbors {
+			maxNeighbors = neighbors
+		}
+	}
+
+	// Most nakade shapes have a vital point next to every other point. The
+	// rest (the square four, bulky five and rabbity six) have one next to
+	// all but one, around a single 2x2 square, which gives them exactly one
+	// more adjacent pair than a shape without loops.
+	return maxNeighbors == size-1 || (maxNeighbors == size-2 && neighborSum/2 == size)
+}
+
+func ptIn(p pt, points []pt) bool {
+	for _, other := range points {
+		if other == p {
+			return true
+		}
+	}
+	return false
+}
+
+// Plays one of the points around the last move that matches a pattern.
+// Returns false if there isn't one.
+func (b *board) playPatternMove(rand Randomness) bool {
+	if b.moveCount == 0 {
+		return false
+	}
+	last := b.moves[b.moveCount-1] & MOVE_TO_PT_MASK
+	if last == PASS {
+		return false
+	}
+	count := 0
+	for _, offset := range b.patternOffsets {
+		p := last + offset
+		if b.cells[p] == EMPTY && patterns[b.patternAt(p)] {
+			b.candidates[count] = p
+			count++
+		}
+	}
+	return b.tryCandidates(count, rand)
+}
+
+// === 3x3 patterns ===
+
+// A pattern describes the eight points around an empty point. They're
+// written as three rows of three characters, top row first, where the middle
+// is the empty point. Each pattern also matches when rotated, reflected, or
+// with the colors swapped. The characters are:
+//
+//	X  a black stone     x  not a black stone (empty, white or edge)
+//	O  a white stone     o  not a white stone (empty, black or edge)
+//	.  empty             ?  anything
+//	   (a space) off the edge of the board
+//
+// These are the hane, cut and edge patterns from MoGo, as listed in Michi. [1]
+//
+// [1] https://github.com/pasky/michi
+var patternSource = [][3]string{
+	{"XOX", // hane: enclosing hane
+		"...",
+		"???"},
+	{"XO.", // hane: non-cutting hane
+		"...",
+		"?.?"},
+	{"XO?", // hane: magari
+		"X..",
+		"x.?"},
+	{".O.", // katatsuke or diagonal attachment
+		"X..",
+		"..."},
+	{"XO?", // cut: unprotected cut
+		"O.o",
+		"?o?"},
+	{"XO?", // cut: peeping cut
+		"O.X",
+		"???"},
+	{"?X?", // cut: de
+		"O.O",
+		"ooo"},
+	{"OX?", // cut: keima
+		"o.O",
+		"???"},
+	{"X.?", // edge: chase
+		"O.?",
+		"   "},
+	{"OX?", // edge: block side cut
+		"X.O",
+		"   "},
+	{"?X?", // edge: block side connection
+		"x.O",
+		"   "},
+	{"?XO", // edge: sagari
+		"x.x",
+		"   "},
+	{"?OX", // edge: cut
+		"X.O",
+		"   "},
+}
+
+// Whether each 3x3 neighborhood matches a pattern, indexed by patternAt.
+var patterns [1 << 16]bool
+
+// The value of each cell in a neighborhood (two bits each), indexed by cell.
+var patternValues = [...]int{EMPTY: 0, WHITE: 1, BLACK: 2, EDGE: 3}
+
+// Returns the neighborhood of a point, for looking up in patterns.
+func (b *board) patternAt(p pt) int {
+	code := 0
+	for i, offset := range b.patternOffsets {
+		code |= patternValues[b.cells[p+offset]] << uint(2*i)
+	}
+	return code
+}
+
+func init() {
+	for _, rows := range patternSource {
+		var grid [9]byte
+		for r, row := range rows {
+			copy(grid[r*3:], row)
+		}
+		for swap := 0; swap < 2; swap++ {
+			for reflect := 0; reflect < 2; reflect++ {
+				for rotate := 0; rotate < 4; rotate++ {
+					addPattern(grid, 0, 0)
+					grid = rotatePattern(grid)
+				}
+				grid = reflectPattern(grid)
+			}
+			grid = swapPatternColors(grid)
+		}
+	}
+}
+
+// The cells that each pattern character matches.
+var patternChars = map[byte][]int{
+	'X': {2}, 'O': {1}, '.': {0}, ' ': {3},
+	'x': {0, 1, 3}, 'o': {0, 2, 3}, '?': {0, 1, 2, 3},
+}
+
+// Adds every neighborhood matching the grid to patterns, starting with the
+// given neighbor (in the order of patternOffsets) and code so far.
+func addPattern(grid [9]byte, neighbor, code int) {
+	if neighbor == 8 {
+		patterns[code] = true
+		return
+	}
+	i := neighbor
+	if i >= 4 {
+		i++ // skip the middle
+	}
+	for _, value := range patternChars[grid[i]] {
+		addPattern(grid, neighbor+1, code|value<<uint(2*neighbor))
+	}
+}
+
+func rotatePattern(grid [9]byte) (result [9]byte) {
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			result[c*3+2-r] = grid[r*3+c]
+		}
+	}
+	return result
+}
+
+func reflectPattern(grid [9]byte) (result [9]byte) {
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			result[r*3+2-c] = grid[r*3+c]
+		}
+	}
+	return result
+}
+
+var swappedPatternChars = map[byte]byte{'X': 'O', 'O': 'X', 'x': 'o', 'o': 'x'}
+
+func swapPatternColors(grid [9]byte) [9]byte {
+	for i, c := range grid {
+		if swapped, ok := swappedPatternChars[c]; ok {
+			grid[i] = swapped
+		}
+	}
+	return grid
+}
@@ -0,0 +1,258 @@
+package gongo
+
+import (
+	"testing"
+)
+
+func TestPatterns(t *testing.T) {
+	b := makeBoard(`
+.....
+.@O@.
+.....
+.O@O.
+.....`)
+	checkPattern(t, &b, 3, 3, true)  // enclosing hane
+	checkPattern(t, &b, 3, 5, true)  // the same, upside down
+	checkPattern(t, &b, 3, 1, true)  // the same, with colors swapped
+	checkPattern(t, &b, 1, 5, false) // nothing nearby
+	checkPattern(t, &b, 5, 3, false)
+}
+
+func TestHeavyPolicyAnswersLastMove(t *testing.T) {
+	b := makeBoard(`
+.....
+.@O@.
+.....
+.....
+.....`)
+	last := b.moves[b.moveCount-1] & MOVE_TO_PT_MASK
+	before := b
+	if !b.playPatternMove(&defaultRandomness) {
+		t.Fatal("expected to play a move matching a pattern")
+	}
+	move := b.moves[b.moveCount-1] & MOVE_TO_PT_MASK
+	near := false
+	for _, offset := range b.patternOffsets {
+		near = near || move == last+offset
+	}
+	if !near || !patterns[before.patternAt(move)] {
+		x, y := b.getCoords(move)
+		t.Errorf("unexpected move: %v,%v", x, y)
+	}
+
+	// nothing matches next to a pass
+	b.makeMove(PASS)
+	if b.playPatternMove(&defaultRandomness) {
+		t.Error("expected no pattern move after a pass")
+	}
+}
+
+func TestCountLiberties(t *testing.T) {
+	b := makeBoard(`
+.....
+.@@..
+.O@..
+..O..
+.....`)
+	checkLiberties(t, &b, 2, 4, 9, 5, 3)
+	checkLiberties(t, &b, 2, 4, 2, 2, 3) // stops at max
+	checkLiberties(t, &b, 2, 3, 9, 2, 1)
+	checkBoard(t, &b, `
+.....
+.@@..
+.O@..
+..O..
+.....`)
+}
+
+func TestAtariCapturesLastMove(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.....
+.....
+@.@..`)
+	b.Play(White, 2, 1)
+	checkAtariMove(t, &b, `
+.....
+.....
+.....
+.@...
+@.@..`)
+}
+
+func TestAtariEscapes(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.O@O.
+.....
+.....`)
+	b.Play(White, 3, 4)
+	checkAtariMove(t, &b, `
+.....
+..O..
+.O@O.
+..@..
+.....`)
+}
+
+func TestAtariCapturesToSave(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.....
+@O@..
+.@...`)
+	b.Play(White, 1, 3)
+	checkAtariMove(t, &b, `
+.....
+.....
+O@...
+@.@..
+.@...`)
+}
+
+func TestAtariDoesNotEscapeIntoAtari(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.....
+.O...
+@....`)
+	b.Play(White, 2, 1)
+	moveCount := b.moveCount
+	if b.playAtariMove() || b.moveCount != moveCount {
+		t.Error("expected no move when escaping doesn't help")
+	}
+	checkBoard(t, &b, `
+.....
+.....
+.....
+.O...
+@O...`)
+}
+
+func TestSelfAtari(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.O...
+O@O..
+O....`)
+	checkSelfAtari(t, &b, 2, 1, true)
+	checkSelfAtari(t, &b, 4, 4, false)
+
+	// a throw-in
+	b = makeBoard(`
+.....
+.....
+.....
+.O...
+..O..`)
+	checkSelfAtari(t, &b, 2, 1, false)
+
+	// straight three and square four are nakade; straight four isn't
+	b = makeBoard(`
+.....
+.....
+.....
+OOO..
+@..O.`)
+	checkSelfAtari(t, &b, 2, 1, false)
+	b = makeBoard(`
+.....
+.....
+OO...
+..O..
+@@O..`)
+	checkSelfAtari(t, &b, 1, 2, false)
+	b = makeBoard(`
+.....
+.....
+.....
+OOOO.
+@@..O`)
+	checkSelfAtari(t, &b, 3, 1, true)
+}
+
+func TestPlayoutAvoidsSelfAtari(t *testing.T) {
+	b := makeBoard(`
+.....
+.....
+.O...
+O@O..
+O....`)
+	b.candidates[0] = b.makePt(2, 1)
+	if b.tryCandidates(1, &defaultRandomness) {
+		t.Error("expected B1 to be skipped")
+	}
+}
+
+func TestGenMoveAvoidsSelfAtari(t *testing.T) {
+	r := NewRobot(5).(*robot)
+	setUpBoard(r, `
+.....
+.....
+.....
+OOOO.
+@@..O`)
+	r.prepareRoot()
+	for _, child := range r.root.children {
+		if child.move == r.board.makePt(3, 1) {
+			t.Error("expected C1 not to be considered")
+		}
+	}
+}
+
+func TestPlayGameWithPolicy(t *testing.T) {
+	var b board
+	for size := 2; size <= 9; size++ {
+		b.clearBoard(size)
+		b.policy = heavyPolicy{}
+		b.playRandomGame(&defaultRandomness)
+		if b.moveCount < 2 || b.moves[b.moveCount-1]&MOVE_TO_PT_MASK != PASS ||
+			b.moves[b.moveCount-2]&MOVE_TO_PT_MASK != PASS {
+			if b.moveCount < len(b.allPoints)*3 {
+				t.Errorf("game on size %v didn't end with two passes", size)
+			}
+		}
+	}
+}
+
+func TestGenMoveWithHeavyPlayouts(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 9, SampleCount: 200, Playouts: HeavyPlayouts})
+	checkGenAnyMove(t, r, Black)
+	checkGenAnyMove(t, r, White)
+}
+
+func checkLiberties(t *testing.T, b *board, x, y, max, expectedLiberties, expectedChain int) {
+	libertyCount, chainCount := b.countLiberties(b.makePt(x, y), max)
+	if libertyCount != expectedLiberties {
+		t.Errorf("expected %v liberties at %v,%v but got %v", expectedLiberties, x, y, libertyCount)
+	}
+	if libertyCount < max && chainCount != expectedChain {
+		t.Errorf("expected %v stones at %v,%v but got %v", expectedChain, x, y, chainCount)
+	}
+}
+
+func checkAtariMove(t *testing.T, b *board, expectedBoard string) {
+	if !b.playAtariMove() {
+		t.Fatal("expected a move")
+	}
+	checkBoard(t, b, expectedBoard)
+}
+
+func checkPattern(t *testing.T, b *board, x, y int, expected bool) {
+	if actual := patterns[b.patternAt(b.makePt(x, y))]; actual != expected {
+		t.Errorf("expected pattern match at %v,%v to be %v", x, y, expected)
+	}
+}
+
+func checkSelfAtari(t *testing.T, b *board, x, y int, expected bool) {
+	before := copyBoard(b)
+	if actual := b.isSelfAtari(b.makePt(x, y)); actual != expected {
+		t.Errorf("expected self-atari at %v,%v to be %v", x, y, expected)
+	}
+	checkSameBoard(t, before, b)
+}
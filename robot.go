@@ -12,6 +12,7 @@ import (
 	"math"
 	"math/rand"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -31,11 +32,71 @@ var defaultRandomness = randomness{src: rand.NewSource(time.Now().Unix())}
 
 type Config struct {
 	BoardSize   int
-	SampleCount int // number of random samples to take to estimate each move
-	Randomness  Randomness
-	Log         *log.Logger
+	SampleCount int     // number of playouts to run when searching for each move
+	Exploration float64 // UCB1 exploration constant; higher values search more widely
+
+	// If set, the robot searches for this long before choosing each move,
+	// instead of running a fixed number of playouts. (If SampleCount is also
+	// set, it's an upper limit.) The search stops early if the best move can't
+	// be overtaken in the time remaining. If the controller sets time limits,
+	// the robot budgets its time from the clock instead.
+	MoveTime time.Duration
+
+	// The RAVE equivalence parameter: the number of visits to a node at which
+	// its own win rate and its RAVE (All Moves As First) win rate are given equal
+	// weight. Zero means use the default; a negative value turns RAVE off.
+	RaveEquivalence float64
+
+	// How moves are chosen in playouts. The default is UniformPlayouts.
+	Playouts PlayoutPolicy
+
+	// The number of goroutines to run playouts on. Each goroutine gets its own
+	// board and source of randomness. Zero means one.
+	Threads int
+
+	// The robot resigns when the estimated win rate of its best move is below
+	// ResignThreshold (for example, 0.1 for 10%) for ResignMoves of its moves
+	// in a row. It doesn't resign before move number ResignMinMove (counting
+	// both players' moves). A ResignThreshold of zero means never resign;
+	// ResignMoves defaults to 3.
+	ResignThreshold float64
+	ResignMoves     int
+	ResignMinMove   int
+
+	// The rules of the game. The default is area scoring with positional
+	// superko, where suicide is illegal.
+	Rules Rules
+
+	// Which repeated positions are illegal; a shorthand for Rules.KoRule.
+	// If set to something other than positional superko, it replaces the
+	// ko rule in Rules.
+	KoRule KoRule
+
+	// If set, the robot keeps searching in the background after GenMove,
+	// on the opponent's time. If the opponent plays a move that was searched,
+	// the results are used for the next GenMove. Methods that change the
+	// position or the scoring, or that score or analyze the position, stop
+	// the search first.
+	Ponder bool
+
+	Randomness Randomness
+	Log        *log.Logger
 }
 
+// The ways of choosing moves in playouts, the random games played to
+// estimate who is winning.
+type PlayoutPolicy int
+
+const (
+	// Any move that doesn't fill in an eye, chosen uniformly at random.
+	// This is the fastest, but its estimates are noisy on large boards.
+	UniformPlayouts PlayoutPolicy = 0
+
+	// Prefer answering the last move where a 3x3 pattern matches (such as
+	// a hane or a cut), otherwise play randomly.
+	HeavyPlayouts PlayoutPolicy = 1
+)
+
 func NewRobot(boardSize int) GoRobot {
 	return NewConfiguredRobot(Config{BoardSize: boardSize})
 }
@@ -45,21 +106,56 @@ func NewConfiguredRobot(config Config) GoRobot {
 	result.board = new(board)
 	result.scratchBoard = new(board)
 
+	if config.Randomness != nil {
+		result.randomness = config.Randomness
+	} else {
+		result.randomness = &defaultRandomness
+	}
+	threads := 1
+	if config.Threads > 0 {
+		threads = config.Threads
+	}
+	if config.Playouts == HeavyPlayouts {
+		result.policy = heavyPolicy{}
+	}
+	result.searchers = make([]*searcher, threads)
+	result.searchers[0] = &searcher{randomness: result.randomness}
+	for i := 1; i < threads; i++ {
+		// rand.Source isn't safe for concurrent use, so each goroutine gets its own
+		seed := int64(result.randomness.Intn(math.MaxInt32))
+		result.searchers[i] = &searcher{randomness: &randomness{src: rand.NewSource(seed)}}
+	}
+
 	if config.BoardSize > 0 {
 		result.SetBoardSize(config.BoardSize)
 	} else {
 		result.SetBoardSize(9)
 	}
-	if config.SampleCount > 0 {
-		result.sampleCount = config.SampleCount
+	result.sampleCount = config.SampleCount
+	result.moveTime = config.MoveTime
+	if config.Exploration > 0 {
+		result.exploration = config.Exploration
 	} else {
-		result.sampleCount = 1000
+		result.exploration = 1.0
 	}
-	if config.Randomness != nil {
-		result.randomness = config.Randomness
+	if config.RaveEquivalence > 0 {
+		result.raveEquivalence = config.RaveEquivalence
+	} else if config.RaveEquivalence == 0 {
+		result.raveEquivalence = 1000
+	}
+	result.resignThreshold = config.ResignThreshold
+	if config.ResignMoves > 0 {
+		result.resignMoves = config.ResignMoves
 	} else {
-		result.randomness = &defaultRandomness
+		result.resignMoves = defaultResignMoves
 	}
+	result.resignMinMove = config.ResignMinMove
+	result.ponder = config.Ponder
+	rules := config.Rules
+	if config.KoRule != PositionalSuperko {
+		rules.KoRule = config.KoRule
+	}
+	result.SetRules(rules)
 	if config.Log != nil {
 		result.log = config.Log
 	} else {
@@ -127,6 +223,8 @@ const (
 
 func colorToCell(c Color) cell {
 	switch c {
+	case Empty:
+		return EMPTY
 	case White:
 		return WHITE
 	case Black:
@@ -146,7 +244,7 @@ func (c cell) toColor() Color {
 	}
 
 	// might happens if we pick up an edge or forget to clear CELL_IN_CHAIN
-	panic(fmt.Sprintf("can't convert cell to color: %s", c))
+	panic(fmt.Sprintf("can't convert cell to color: %d", c))
 }
 
 // A pt represents either a point on the Go board or a player's move. When
@@ -163,7 +261,21 @@ const (
 	// (Used in r.moves to find simple Kos.)
 	ONE_CAPTURE = 1024
 
-	// A mask to remove the ONE_CAPTURE flag from a move, resulting in a point.
+	// A flag on a recorded move indicating that White made it. (The side to move
+	// doesn't always alternate, so undo needs to know whose move it was.)
+	WHITE_MOVE = 2048
+
+	// A flag on a recorded move indicating that it captured the player's own
+	// stones, including the one played. (Only when suicide is allowed.)
+	SUICIDE_MOVE = 4096
+
+	// A flag on a point in b.captured marking the head of a captured chain.
+	// The rest of the chain follows it, in order, so that undo can put the
+	// chain back the way it was.
+	CAPTURED_HEAD = 1024
+
+	// A mask to remove the flags from a move, resulting in a point.
+	// (Also removes CAPTURED_HEAD from a captured point.)
 	MOVE_TO_PT_MASK = 1023
 )
 
@@ -217,17 +329,61 @@ type board struct {
 	dirOffset  [4]pt // amount to add to a pt to move in each cardinal direction
 	diagOffset [4]pt // amount to add to a pt to move in each diagonal direction
 
+	// amounts to add to a pt to get its eight neighbors, in reading order (see patternAt)
+	patternOffsets [8]pt
+
 	cells          [maxStride*maxRowCount + 1]cell
 	allPoints      []pt  // List of all points on the board. (Skips barrier cells.)
 	neighborCounts []int // Holds counts of how many neighbors a cell has (4 - liberties)
 
-	// List of moves in this game
+	// The chain each stone belongs to, indexed by pt (see chain.go)
+	chainHead      [maxStride*maxRowCount + 1]pt  // the head of the stone's chain
+	nextStone      [maxStride*maxRowCount + 1]pt  // the next stone in the same chain
+	chainSize      [maxStride*maxRowCount + 1]int // the number of stones, indexed by head
+	libertyCounts  [maxStride*maxRowCount + 1]int // the number of liberties, indexed by head
+	chainLiberties []uint64                       // a liberty set for each head
+	libertyWords   int                            // the size of each liberty set
+
+	// The color of the player who moves next
+	toPlay cell
+
+	// Whether a move may capture the player's own stones (see Rules)
+	suicideAllowed bool
+
+	// How playRandomGame chooses moves; nil for uniform playouts
+	policy playoutPolicy
+
+	// The number of stones of each color captured in this game (indexed by cell)
+	prisoners [3]int
+
+	// The Zobrist hash of the stones on the board, updated as they're
+	// placed and removed. (See getHash.)
+	hash uint64
+
+	// List of moves in this game, not including setup stones
 	moves           []pt
 	moveCount       int
 	commonMoveCount int // used to avoid recopying moves between boards
 
+	// Undo information: the points of all stones captured in this game, in order,
+	// and the number of captured stones before each move.
+	captured      []pt
+	capturedCount int
+	captureStart  []int
+
+	// More undo information: the chain merges made by each move, in order,
+	// with the liberty words that each one changed, and the number of merges
+	// before each move. (See splitChains.)
+	merges         []chainMerge
+	mergeCount     int
+	mergeWords     []mergedWord
+	mergeWordCount int
+	mergeStart     []int
+
 	// Scratch variables, reused to avoid GC:
-	chainPoints []pt // return value of markSurroundedChain
+	chainPoints []pt // return value of listChain; used when rebuilding chains
+	liberties   []pt // return value of countLiberties
+	savedChain  []pt // used by saveChain
 	candidates  []pt // moves to choose from; used in playRandomGame.
 }
 
@@ -245,10 +401,19 @@ func (b *board) clearBoard(newSize int) (ok bool) {
 	b.diagOffset[1] = pt(b.stride + 1)  // ne
 	b.diagOffset[2] = pt(-b.stride - 1) // sw
 	b.diagOffset[3] = pt(-b.stride + 1) // se
+	b.patternOffsets = [8]pt{
+		b.diagOffset[0], b.dirOffset[2], b.diagOffset[1],
+		b.dirOffset[1], b.dirOffset[0],
+		b.diagOffset[2], b.dirOffset[3], b.diagOffset[3],
+	}
 
 	b.allPoints = make([]pt, b.size*b.size)
 	b.neighborCounts = make([]int, len(b.cells))
 
+	// one bit for each point up to the last one on the board
+	b.libertyWords = (b.size*b.stride + b.size + 64) / 64
+	b.chainLiberties = make([]uint64, (b.size*b.stride+b.size+1)*b.libertyWords)
+
 	// fill entire array with board edge
 	for i := 0; i < len(b.cells); i++ {
 		b.cells[i] = EDGE
@@ -272,9 +437,28 @@ func (b *board) clearBoard(newSize int) (ok bool) {
 	// assumes no game lasts longer than it would take to fill the board at four times (plus some extra)
 	b.moves = make([]pt, len(b.cells)*4)
 	b.moveCount = 0
+	b.toPlay = BLACK
+	b.hash = 0
 	b.commonMoveCount = 0
 
+	// each stone can only be captured once, so there can't be more captures than
+	// moves plus setup stones (which can be captured without being moves)
+	b.captured = make([]pt, len(b.moves)+len(b.allPoints))
+	b.capturedCount = 0
+	b.captureStart = make([]int, len(b.moves))
+
+	// each move adds a chain and each merge takes one away, so there can't be
+	// more merges than moves plus setup stones either
+	b.merges = make([]chainMerge, len(b.moves)+len(b.allPoints))
+	b.mergeCount = 0
+	b.mergeWords = make([]mergedWord, len(b.merges)*b.libertyWords)
+	b.mergeWordCount = 0
+	b.mergeStart = make([]int, len(b.moves))
+	b.prisoners = [3]int{}
+
 	b.chainPoints = make([]pt, len(b.allPoints))
+	b.liberties = make([]pt, len(b.allPoints))
+	b.savedChain = make([]pt, len(b.allPoints))
 	b.candidates = make([]pt, len(b.allPoints))
 	return true
 }
@@ -290,15 +474,70 @@ func (b *board) Play(color Color, x, y int) (ok bool, message string) {
 		return false, "invalid args"
 	}
 
-	if !b.isMyTurn(color) {
-		// assume the other player passed
-		if ok, message := b.Play(color.GetOpponent(), 0, 0); !ok {
-			return false, "other side cannot pass? (" + message + ")"
+	toPlay := b.toPlay
+	b.toPlay = colorToCell(color)
+	result, captures := b.makeMove(b.makePt(x, y))
+	if !result.ok() {
+		b.toPlay = toPlay
+	}
+	return result.toPlayResult(captures)
+}
+
+func (b *board) SetStone(color Color, x, y int) (ok bool, message string) {
+	if !b.checkSetStoneArgs(color, x, y) {
+		return false, "invalid args"
+	}
+	return b.setStone(b.makePt(x, y), colorToCell(color))
+}
+
+func (b *board) GetToPlay() Color { return b.toPlay.toColor() }
+
+func (b *board) SetToPlay(color Color) { b.toPlay = colorToCell(color) }
+
+// Adds or removes a setup stone. Setup stones aren't moves, so they can only
+// be placed before the first move. A stone can't be placed where it (or a
+// neighboring chain) would have no liberties, since nothing is captured.
+func (b *board) setStone(p pt, stone cell) (ok bool, message string) {
+	if b.moveCount > 0 {
+		return false, "setup stones must be placed before the first move"
+	}
+	old := b.cells[p]
+	if old == stone {
+		return true, ""
+	}
+
+	if old != EMPTY {
+		b.cells[p] = EMPTY
+		b.hash ^= zobristStones[old][p]
+		for dir := 0; dir < 4; dir++ {
+			b.neighborCounts[p+b.dirOffset[dir]]--
 		}
+		b.clearChainMarks(b.rebuildChainsAround(p, 0))
+	}
+	if stone == EMPTY {
+		return true, ""
 	}
 
-	result, captures := b.makeMove(b.makePt(x, y))
-	return result.toPlayResult(captures)
+	b.placeStone(p, stone)
+	b.mergeCount = 0 // setup stones can't be undone
+	b.mergeWordCount = 0
+	if b.isSurrounded(p) {
+		b.setStone(p, old)
+		return false, "no liberties"
+	}
+	for dir := 0; dir < 4; dir++ {
+		neighborPt := p + b.dirOffset[dir]
+		if (b.cells[neighborPt] == WHITE || b.cells[neighborPt] == BLACK) && b.isSurrounded(neighborPt) {
+			b.setStone(p, old)
+			return false, "neighbor would have no liberties"
+		}
+	}
+	return true, ""
+}
+
+// Returns true if the chain containing the stone at the given point has no liberties.
+func (b *board) isSurrounded(p pt) bool {
+	return !b.hasLiberties(p)
 }
 
 func (b *board) checkPlayArgs(color Color, x, y int) bool {
@@ -311,7 +550,14 @@ func (b *board) checkPlayArgs(color Color, x, y int) bool {
 	return x > 0 && y > 0 && x <= b.size && y <= b.size
 }
 
-func (b *board) isMyTurn(c Color) bool { return b.getFriendlyStone() == colorToCell(c) }
+func (b *board) checkSetStoneArgs(color Color, x, y int) bool {
+	if color != Empty && color != White && color != Black {
+		return false
+	}
+	return x > 0 && y > 0 && x <= b.size && y <= b.size
+}
+
+func (b *board) isMyTurn(c Color) bool { return b.toPlay == colorToCell(c) }
 
 func (b *board) makePt(x, y int) pt { return pt(y*b.stride + x) }
 
@@ -322,32 +568,57 @@ func (b *board) getCoords(p pt) (x, y int) {
 }
 
 // Returns a cell with the correct color stone for the current player's next move
-func (b *board) getFriendlyStone() cell { return cell(2 - (b.moveCount & 1)) }
+func (b *board) getFriendlyStone() cell { return b.toPlay }
+
+// === Zobrist hashing ===
+
+// A Zobrist hash is the XOR of a random number for each stone on the board
+// (one for each combination of point and color). It can be updated as stones
+// are placed and captured, instead of being recalculated from scratch.
+// Other random numbers are added for who plays next and for a ko.
+
+var (
+	zobristStones      [3][maxStride*maxRowCount + 1]uint64 // indexed by cell and pt
+	zobristKo          [maxStride*maxRowCount + 1]uint64    // indexed by the point of the ko's last move
+	zobristWhiteToPlay uint64
+)
+
+func init() {
+	// A fixed seed, so that hashes are the same from one run to the next.
+	random := rand.New(rand.NewSource(1))
+	for p := range zobristKo {
+		zobristStones[WHITE][p] = random.Uint64()
+		zobristStones[BLACK][p] = random.Uint64()
+		zobristKo[p] = random.Uint64()
+	}
+	zobristWhiteToPlay = random.Uint64()
+}
 
-// Returns a hash of the current board position, useful for determining whether
+// Returns a hash of the stones on the board, useful for determining whether
 // we repeated a board position.
-// Based on the hash() function from the Java reference bot:
-/* ------------------------------------------------------------
-   get a hash of current position - calculating from scratch
-
-   Note: this is DJB hash which was designed for 32 bits even
-   though we are using it as a 64 bit hash
-
-   Should be using the superior zobrist hash but I'm lazy,
-   this is easier, and performance is not an issue the way it's
-   used here.
-   ------------------------------------------------------------ */
-func (b *board) getHash() int64 {
-	var k int64 = 5381
-	for _, pt := range b.allPoints {
-		k = ((k << 5) + k) + int64(b.cells[pt])
+func (b *board) getHash() uint64 { return b.hash }
+
+// Returns a hash of the stones on the board, who plays next, and whether the
+// last move captured a stone that could start a ko. Positions with the same
+// full hash have the same legal moves.
+func (b *board) getFullHash() uint64 {
+	hash := b.hash
+	if b.toPlay == WHITE {
+		hash ^= zobristWhiteToPlay
+	}
+	if b.moveCount > 0 {
+		if lastMove := b.moves[b.moveCount-1]; lastMove&ONE_CAPTURE != 0 {
+			hash ^= zobristKo[lastMove&MOVE_TO_PT_MASK]
+		}
 	}
-	return k
+	return hash
 }
 
 // Copies the board and move list from another board of the same size.
 // Restriction: the same board must be passed to copyFrom() each time,
 // and the other board's move list can only be appended to between copies.
+// (Call forgetMovesAfter if moves were undone.) The copy can't undo moves
+// made before it was copied.
 func (b *board) copyFrom(other *board) {
 	if b.size != other.size {
 		panic("boards must be same size")
@@ -355,7 +626,12 @@ func (b *board) copyFrom(other *board) {
 	for _, pt := range b.allPoints {
 		b.cells[pt] = other.cells[pt]
 		b.neighborCounts[pt] = other.neighborCounts[pt]
+		b.chainHead[pt] = other.chainHead[pt]
+		b.nextStone[pt] = other.nextStone[pt]
+		b.chainSize[pt] = other.chainSize[pt]
+		b.libertyCounts[pt] = other.libertyCounts[pt]
 	}
+	copy(b.chainLiberties, other.chainLiberties)
 
 	// top off move list; assumes other board may have appended some moves
 	for i := b.commonMoveCount; i < other.moveCount; i++ {
@@ -363,10 +639,29 @@ func (b *board) copyFrom(other *board) {
 	}
 	b.moveCount = other.moveCount
 	b.commonMoveCount = other.moveCount
+	b.capturedCount = other.capturedCount
+	b.mergeCount = other.mergeCount
+	b.mergeWordCount = other.mergeWordCount
+	b.prisoners = other.prisoners
+	b.toPlay = other.toPlay
+	b.hash = other.hash
 }
 
-// Fill the board with a randomly-generated game
+// Tells a board that's copied from another board that moves after the given
+// move number were undone on the other board, so they need to be copied again.
+func (b *board) forgetMovesAfter(moveCount int) {
+	if b.commonMoveCount > moveCount {
+		b.commonMoveCount = moveCount
+	}
+}
+
+// Fill the board with a randomly-generated game, using the board's playout
+// policy if it has one.
 func (b *board) playRandomGame(rand Randomness) {
+	if b.policy != nil {
+		b.playGameWithPolicy(rand)
+		return
+	}
 	maxMoves := len(b.allPoints) * 3
 
 captured:
@@ -435,40 +730,57 @@ captured:
 // assuming the game has been played to the end where all empty points
 // are surrounded. (Doesn't include komi.)
 func (b *board) getEasyScore() int {
-	// 0=unused, 1=white, 2=black
-	// 3=surrounded by both (no score; missed point under area scoring)
-	var cellCounts [4]int
+	// 0=neutral (no score; missed point under area scoring), 1=white, 2=black
+	var cellCounts [3]int
 
 	for _, pt := range b.allPoints {
-		switch cell := b.cells[pt]; cell {
-		case BLACK, WHITE:
-			cellCounts[cell]++
-		case EMPTY:
-			// Find which neighbors are present by OR-ing the cells together.
-			// (This works because WHITE and BLACK are single bits and 3 is
-			// not used on the board.)
-			neighborBits := 0
-			for direction := 0; direction < 4; direction++ {
-				neighborCell := b.cells[pt+b.dirOffset[direction]]
-				neighborBits = neighborBits | int(neighborCell)
-			}
-			cellCounts[neighborBits&3]++
-		}
+		cellCounts[b.getEasyOwner(pt)]++
 	}
 	return cellCounts[BLACK] - cellCounts[WHITE]
 }
 
+// Returns the player who gets a point under area scoring, with the same
+// assumption as getEasyScore: the color of the stone on it, or the color
+// surrounding it if it's empty. Returns EMPTY for an empty point that is
+// surrounded by both colors (or by neither, on an empty board).
+func (b *board) getEasyOwner(p pt) cell {
+	switch cell := b.cells[p]; cell {
+	case BLACK, WHITE:
+		return cell
+	}
+
+	// Find which neighbors are present by OR-ing the cells together.
+	// (This works because WHITE and BLACK are single bits and 3 is
+	// not used on the board.)
+	neighborBits := 0
+	for direction := 0; direction < 4; direction++ {
+		neighborCell := b.cells[p+b.dirOffset[direction]]
+		neighborBits = neighborBits | int(neighborCell)
+	}
+	if owner := cell(neighborBits & 3); owner != 3 {
+		return owner
+	}
+	return EMPTY
+}
+
 // A fast version of makeMove() that's good enough for playouts.
 // If the given move is legal, update the board, and return true along
 // with the number of captures. Otherwise, do nothing and return false.
 // Doesn't check superko or update boardHashes.
 func (b *board) makeMove(move pt) (result moveResult, captures int) {
-	friendlyStone := cell(2 - (b.moveCount & 1))
+	friendlyStone := b.toPlay
 	enemyStone := friendlyStone ^ 3
+	var colorFlag pt
+	if friendlyStone == WHITE {
+		colorFlag = WHITE_MOVE
+	}
 
 	if move == PASS {
-		b.moves[b.moveCount] = PASS
+		b.moves[b.moveCount] = PASS | colorFlag
+		b.captureStart[b.moveCount] = b.capturedCount
+		b.mergeStart[b.moveCount] = b.mergeCount
 		b.moveCount++
+		b.toPlay = enemyStone
 		return passed, 0
 	}
 
@@ -476,171 +788,170 @@ func (b *board) makeMove(move pt) (result moveResult, captures int) {
 		return occupied, 0
 	}
 
-	// place stone and increment neighbor counts
-	b.cells[move] = friendlyStone
-	b.neighborCounts[move-1]++
-	b.neighborCounts[move+1]++
-	b.neighborCounts[move-pt(b.stride)]++
-	b.neighborCounts[move+pt(b.stride)]++
-
-	// find any captures and remove them from the board
+	// Find out what the move would capture before changing anything.
+	capturedBefore := b.capturedCount
+	mergesBefore := b.mergeCount
+	var capturedHeads [4]pt
+	capturedChains := 0
 	captures = 0
+	hasLiberty := false
 	for dir := 0; dir < 4; dir++ {
 		neighborPt := move + b.dirOffset[dir]
-		if b.cells[neighborPt] == enemyStone && b.neighborCounts[neighborPt] == 4 {
-			captures += b.capture(neighborPt)
+		switch b.cells[neighborPt] {
+		case EMPTY:
+			hasLiberty = true
+		case friendlyStone:
+			if !b.isOnlyLiberty(neighborPt, move) {
+				hasLiberty = true
+			}
+		case enemyStone:
+			head := b.chainHead[neighborPt]
+			if b.isOnlyLiberty(head, move) && !ptIn(head, capturedHeads[:capturedChains]) {
+				capturedHeads[capturedChains] = head
+				capturedChains++
+				captures += b.chainSize[head]
+			}
 		}
 	}
 
-	if captures == 0 {
-		// check for suicide
-		if b.neighborCounts[move] == 4 && !b.hasLiberties(move) {
-			result = suicide
-			goto revert
+	if captures == 0 && !hasLiberty {
+		if !b.suicideAllowed {
+			return suicide, 0
 		}
-	} else if captures == 1 {
-		// check for simple Ko.
-		lastMove := b.moves[b.moveCount-1]
-		if (lastMove&ONE_CAPTURE) != 0 && // previous move captured one stone
-			b.cells[lastMove&MOVE_TO_PT_MASK] == EMPTY { // this move captured previous move
-			// found a Ko; revert the capture
-			revertPt := lastMove & MOVE_TO_PT_MASK
-			b.cells[revertPt] = enemyStone
-			for dir := 0; dir < 4; dir++ {
-				neighborPt := revertPt&MOVE_TO_PT_MASK + b.dirOffset[dir]
-				b.neighborCounts[neighborPt]++
+		b.placeStone(move, friendlyStone)
+		b.capture(move)
+		move |= SUICIDE_MOVE
+	} else {
+		if captures == 1 && b.moveCount > 0 {
+			// check for simple Ko.
+			lastMove := b.moves[b.moveCount-1]
+			if (lastMove&ONE_CAPTURE) != 0 && // previous move captured one stone
+				capturedHeads[0] == lastMove&MOVE_TO_PT_MASK { // this move would capture previous move
+				return ko, 0
 			}
-			result = ko
-			captures = 0
-			goto revert
 		}
-		move = ONE_CAPTURE | move
+		b.placeStone(move, friendlyStone)
+		for _, head := range capturedHeads[:capturedChains] {
+			b.capture(head)
+		}
+		if captures == 1 {
+			move |= ONE_CAPTURE
+		}
 	}
 
-	b.moves[b.moveCount] = move
+	b.moves[b.moveCount] = move | colorFlag
+	b.captureStart[b.moveCount] = capturedBefore
+	b.mergeStart[b.moveCount] = mergesBefore
 	b.moveCount++
+	b.toPlay = enemyStone
 	return played, captures
-
-revert:
-	// remove previously placed stone and decrement neighbor counts
-	b.cells[move] = EMPTY
-	for dir := 0; dir < 4; dir++ {
-		neighborPt := move&MOVE_TO_PT_MASK + b.dirOffset[dir]
-		b.neighborCounts[neighborPt]--
-	}
-	return
 }
 
-// Given any point in a chain with no liberties, removes all stones in the
-// chain from the board and returns the number of stones removed. Given a
-// point in a chain that has liberties, does nothing and returns 0.
-// Preconditions: same as b.markSurroundedChain
+// Removes the chain containing the given stone from the board, giving its
+// points to the chains around it as liberties, and returns the number of
+// stones removed. The removed stones are added to b.captured, starting with
+// the head.
 func (b *board) capture(target pt) (chainCount int) {
-	chainCount = b.markSurroundedChain(target)
-
-	// Remove the stones from the board and decrement neighbor counts
-	for i := 0; i < chainCount; i++ {
-		removePt := b.chainPoints[i]
-		b.cells[removePt] = EMPTY
+	chainColor := b.cells[target]
+	head := b.chainHead[target]
+	first := b.capturedCount
+	p := head
+	for {
+		b.captured[b.capturedCount] = p
+		b.capturedCount++
+		b.hash ^= zobristStones[chainColor][p]
+		b.cells[p] = EMPTY
 		for dir := 0; dir < 4; dir++ {
-			neighborPt := removePt + b.dirOffset[dir]
+			neighborPt := p + b.dirOffset[dir]
 			b.neighborCounts[neighborPt]--
+			if b.cells[neighborPt] == chainColor^3 {
+				b.addLiberty(b.chainHead[neighborPt], p)
+			}
+		}
+		chainCount++
+		p = b.nextStone[p]
+		if p == head {
+			break
 		}
 	}
+	b.captured[first] |= CAPTURED_HEAD
+	b.prisoners[chainColor] += chainCount
 	return chainCount
 }
 
-// Given any occupied point, returns true if it has any liberties.
-// (Used for testing suicide.)
-// Preconditions: same as b.markSurroundedChain
-func (b *board) hasLiberties(target pt) bool {
-	chainCount := b.markSurroundedChain(target)
-	if chainCount == 0 {
-		return true
+// Takes back the last move, restoring the stones, neighbor counts, chains,
+// and move list to the way they were before it. Returns false if there's no move to undo.
+func (b *board) undo() bool {
+	if b.moveCount == 0 {
+		return false
 	}
-
-	// Revert marked positions
-	for i := 0; i < chainCount; i++ {
-		b.cells[b.chainPoints[i]] ^= CELL_IN_CHAIN
+	b.moveCount--
+	recorded := b.moves[b.moveCount]
+	move := recorded & MOVE_TO_PT_MASK
+	capturedBefore := b.captureStart[b.moveCount]
+
+	// it's the turn of the player who made the move again
+	b.toPlay = BLACK
+	if recorded&WHITE_MOVE != 0 {
+		b.toPlay = WHITE
 	}
-	return false
-}
 
-// Given any point in a chain with no liberties, marks all the cells in
-// the chain with CELL_IN_CHAIN and adds those points to chainPoints.
-// Returns the number of points found. If the chain is not surrounded,
-// does nothing and returns 0.
-// Preconditions: the target point is occupied and has no liberties, and all
-// cells have the CELL_IN_CHAIN flag cleared.
-func (b *board) markSurroundedChain(target pt) (chainCount int) {
-	chainCount = 0
-	chainColor := b.cells[target]
+	if move != PASS {
+		capturedStone := b.toPlay ^ 3
+		if recorded&SUICIDE_MOVE != 0 {
+			// the captured stones include the one that was played
+			capturedStone = b.toPlay
+		}
 
-	b.chainPoints[chainCount] = target
-	chainCount++
-	b.cells[target] |= CELL_IN_CHAIN
-
-	// Visit each point, verify that has no liberties, and add its neighbors to the
-	// end of chainPoints.
-	// Loop invariants:
-	// - Points between 0 and visitedCount-1 are surrounded and their same-color
-	// neighbors are in chainPoints.
-	// - Points between visitedCount and chainCount are known to be in the chain
-	// and to have no liberties, but still need to be visited.
-	for visitedCount := 0; visitedCount < chainCount; visitedCount++ {
-		thisPt := b.chainPoints[visitedCount]
-
-		rightPt := thisPt + pt(1)
-		leftPt := thisPt + pt(-1)
-		upPt := thisPt + pt(b.stride)
-		downPt := thisPt + pt(-b.stride)
-
-		rightCell := b.cells[rightPt]
-		leftCell := b.cells[leftPt]
-		upCell := b.cells[upPt]
-		downCell := b.cells[downPt]
-
-		// add surrounding points to the chain if they're the same color
-		if rightCell == chainColor {
-			if b.neighborCounts[rightPt] != 4 {
-				goto revert
+		// put back the stones it captured
+		for i := capturedBefore; i < b.capturedCount; i++ {
+			restorePt := b.captured[i] & MOVE_TO_PT_MASK
+			b.cells[restorePt] = capturedStone
+			b.hash ^= zobristStones[capturedStone][restorePt]
+			for dir := 0; dir < 4; dir++ {
+				b.neighborCounts[restorePt+b.dirOffset[dir]]++
 			}
-			b.chainPoints[chainCount] = rightPt
-			b.cells[rightPt] |= CELL_IN_CHAIN
-			chainCount++
 		}
-		if leftCell == chainColor {
-			if b.neighborCounts[leftPt] != 4 {
-				goto revert
+		b.prisoners[capturedStone] -= b.capturedCount - capturedBefore
+
+		// Put the captured chains back together, taking their points back
+		// from the chains around them as liberties.
+		start := capturedBefore
+		for i := capturedBefore; i < b.capturedCount; i++ {
+			restorePt := b.captured[i] & MOVE_TO_PT_MASK
+			for dir := 0; dir < 4; dir++ {
+				neighborPt := restorePt + b.dirOffset[dir]
+				if b.cells[neighborPt] == capturedStone^3 {
+					b.removeLiberty(b.chainHead[neighborPt], restorePt)
+				}
 			}
-			b.chainPoints[chainCount] = leftPt
-			b.cells[leftPt] |= CELL_IN_CHAIN
-			chainCount++
-		}
-		if upCell == chainColor {
-			if b.neighborCounts[upPt] != 4 {
-				goto revert
+			if i+1 == b.capturedCount || b.captured[i+1]&CAPTURED_HEAD != 0 {
+				b.restoreChain(b.captured[start : i+1])
+				start = i + 1
 			}
-			b.chainPoints[chainCount] = upPt
-			b.cells[upPt] |= CELL_IN_CHAIN
-			chainCount++
 		}
-		if downCell == chainColor {
-			if b.neighborCounts[downPt] != 4 {
-				goto revert
-			}
-			b.chainPoints[chainCount] = downPt
-			b.cells[downPt] |= CELL_IN_CHAIN
-			chainCount++
+
+		// Remove the stone that was played. (Not before the captured chains
+		// are back: their points have to be taken back as liberties from the
+		// chain this stone is in, too.)
+		b.cells[move] = EMPTY
+		b.hash ^= zobristStones[b.toPlay][move]
+		for dir := 0; dir < 4; dir++ {
+			b.neighborCounts[move+b.dirOffset[dir]]--
 		}
-	}
 
-	return chainCount
-revert:
-	for i := 0; i < chainCount; i++ {
-		b.cells[b.chainPoints[i]] ^= CELL_IN_CHAIN
+		// split the chains the move joined; its point is a liberty again
+		b.splitChains(b.mergeStart[b.moveCount])
+		for dir := 0; dir < 4; dir++ {
+			neighborPt := move + b.dirOffset[dir]
+			if b.cells[neighborPt] == WHITE || b.cells[neighborPt] == BLACK {
+				b.addLiberty(b.chainHead[neighborPt], move)
+			}
+		}
 	}
-	return 0
+	b.capturedCount = capturedBefore
+	b.forgetMovesAfter(b.moveCount)
+	return true
 }
 
 // Returns true if this move would fill in an eye.
@@ -655,7 +966,7 @@ func (b *board) wouldFillEye(move pt) bool {
 	if move == PASS {
 		return false
 	}
-	friendlyStone := cell(2 - (b.moveCount & 1))
+	friendlyStone := b.toPlay
 	enemyStone := friendlyStone ^ 3
 
 	// not an eye unless cardinal directions have friendly stones or edge.
@@ -687,100 +998,168 @@ func (r *robot) String() {}
 // === Implementation of GoRobot interface ===
 
 type robot struct {
-	board       *board
-	randomness  Randomness
-	log         *log.Logger
-	komi        float64
-	sampleCount int
-
-	// Contains a hash of each previous board in the current game,
-	// for determining whether a move would violate positional superko
-	boardHashes []int64
+	board           *board
+	randomness      Randomness
+	log             *log.Logger
+	komi            float64
+	sampleCount     int           // zero to use defaultSampleCount when there's no time limit
+	moveTime        time.Duration // zero if there's no time limit
+	exploration     float64
+	raveEquivalence float64 // zero if RAVE is turned off
+
+	// When to resign (see Config), and how many moves in a row each player's
+	// best move has been below the threshold (indexed by Color)
+	resignThreshold float64
+	resignMoves     int
+	resignMinMove   int
+	hopelessMoves   [3]int
+
+	ponder bool // whether to search on the opponent's time after GenMove
+
+	// Time limits set by the controller, and each player's clock (indexed by Color)
+	timeSettings TimeSettings
+	clocks       [3]clock
+
+	// The stones placed by SetStone before the first move, in order
+	setup []Move
+
+	rules Rules
+
+	// The hash of the board after each move in the current game, and
+	// startHash for the position before the first move. For determining
+	// whether a move would violate superko, seenHashes counts how many times
+	// each position after a move occurs. (See superkoKey.)
+	boardHashes []uint64
+	startHash   uint64
+	seenHashes  map[uint64]int
+
+	// The root of the search tree for the current position, or nil if the
+	// position hasn't been searched. When a move is played, the subtree under
+	// that move becomes the new root and the rest of the tree is dropped.
+	root     *node
+	treeLock sync.Mutex // held while searchers read or update the tree
+
+	// One searcher for each goroutine that runs playouts
+	searchers []*searcher
+	policy    playoutPolicy // for the searchers' boards; nil for uniform playouts
+
+	// The search started by StartSearch, or nil if none is running
+	background *backgroundSearch
+
+	// Who owns each point at the end of the game, estimated for scoring
+	ownership    *ownership
+	ownershipKey positionKey // the position that ownership was estimated for
 
 	// Scratch variables, reused to avoid GC
-	scratchBoard *board
-	candidates   []pt  // moves to choose from; used in GenMove.
-	wins, hits   []int // results of findWins()
+	scratchBoard *board // used for trying moves in prepareRoot and findLadders
 }
 
 func (r *robot) SetBoardSize(newSize int) bool {
+	r.StopSearch()
 	if !r.board.clearBoard(newSize) {
 		return false
 	}
 	r.scratchBoard.clearBoard(newSize)
-	r.boardHashes = make([]int64, len(r.board.moves))
-	r.candidates = make([]pt, len(r.board.allPoints))
-	r.wins = make([]int, len(r.board.cells))
-	r.hits = make([]int, len(r.board.cells))
+	for i, s := range r.searchers {
+		r.searchers[i] = newSearcher(newSize, s.randomness, r.policy)
+	}
+	r.boardHashes = make([]uint64, len(r.board.moves))
+	r.startHash = r.board.getHash()
+	r.seenHashes = make(map[uint64]int)
+	r.setup = nil
+	r.root = nil
+	r.ownership = nil
 	return true
 }
 
-func (r *robot) ClearBoard() { r.SetBoardSize(r.board.size) }
+func (r *robot) ClearBoard() {
+	r.SetBoardSize(r.board.size)
+	r.hopelessMoves = [3]int{}
+	r.clocks[Black].reset(r.timeSettings)
+	r.clocks[White].reset(r.timeSettings)
+}
 
-func (r *robot) SetKomi(value float64) { r.komi = value }
+func (r *robot) SetKomi(value float64) {
+	r.StopSearch()
+	if value == r.komi {
+		return
+	}
+	r.komi = value
+	// the win rates in the tree were scored with the old komi
+	r.root = nil
+	r.ownership = nil
+}
 
 func (r *robot) Play(color Color, x, y int) (ok bool, message string) {
+	r.StopSearch()
 	if !r.board.checkPlayArgs(color, x, y) {
 		return false, "invalid args"
 	}
 
-	if !r.board.isMyTurn(color) {
-		// GTP protocol allows two moves by the same color, to allow a game
-		// to be set up more easily; treat as if the other player passed.
-		if ok, message := r.Play(color.GetOpponent(), 0, 0); !ok {
-			return false, fmt.Sprintf("other side cannot pass? (%v)", message)
-		}
-	}
+	// GTP protocol allows two moves by the same color. This doesn't count
+	// as a pass by the other player; it's their turn again afterwards.
+	toPlay := r.board.toPlay
+	r.board.toPlay = colorToCell(color)
 
 	// use full version of makeMove so we update r.boardHashes
-	result, captures := r.makeMove(r.board.makePt(x, y))
+	move := r.board.makePt(x, y)
+	result, captures := r.makeMove(move)
+	if !result.ok() {
+		r.board.toPlay = toPlay
+		return result.toPlayResult(captures)
+	}
+	r.advanceRoot(move, colorToCell(color))
 	return result.toPlayResult(captures)
 }
 
+func (r *robot) Undo() bool {
+	r.StopSearch()
+	if !r.board.undo() {
+		return false
+	}
+	// it's the turn of the player who made the undone move
+	r.forgetHash(r.superkoKey(r.boardHashes[r.board.moveCount], r.board.toPlay^3))
+	r.scratchBoard.forgetMovesAfter(r.board.moveCount)
+	for _, s := range r.searchers {
+		s.board.forgetMovesAfter(r.board.moveCount)
+	}
+	r.root = nil
+	// the hopeless moves may have been undone
+	r.hopelessMoves = [3]int{}
+	return true
+}
+
 func (r *robot) GenMove(color Color) (x, y int, moveResult MoveResult) {
-	if !r.board.isMyTurn(color) {
-		// GTP protocol allows generating a move by either side;
-		// treat as if the other player passed.
-		if ok, message := r.Play(color.GetOpponent(), 0, 0); !ok {
-			panic(fmt.Sprintf("other side cannot pass? %s", message))
-		}
+	r.StopSearch()
+
+	// GTP protocol allows generating a move by either side.
+	r.SetToPlay(color)
+	r.prepareRoot()
+	if r.root.visits > 0 {
+		r.log.Printf("reusing %v playouts from earlier searches", r.root.visits)
 	}
 
 	startTime := time.Now()
-	r.findWins(r.sampleCount)
+	playouts := r.search(r.searchLimit(color, startTime))
 	stopTime := time.Now()
+	r.clocks[color].spend(stopTime.Sub(startTime), r.timeSettings)
 	elapsedTimeSecs := float64(stopTime.Sub(startTime)) / math.Pow10(9)
-	r.log.Printf("playouts/second: %.0f", float64(r.sampleCount)/elapsedTimeSecs)
-
-	// create a list of possible moves
-	candidates := r.candidates // reuse array to avoid allocation
-	candidateCount := 0
-	for _, pt := range r.board.allPoints {
-		if r.hits[pt] > 0 && !r.board.wouldFillEye(pt) && r.checkLegalMove(pt) == played {
-			candidates[candidateCount] = pt
-			candidateCount++
-		}
-	}
+	r.log.Printf("playouts: %v, playouts/second: %.0f", playouts, float64(playouts)/elapsedTimeSecs)
 
-	// choose best move by iterating through candidates
-	// (randomly permuted to break ties randomly)
+	best := r.root.bestChild()
+	if r.shouldResign(color, best) {
+		return 0, 0, Resigned
+	}
 	bestMove := PASS
-	bestScore := float64(-99.0)
-	for i := 0; i < candidateCount; i++ {
-
-		// permute
-		randomIndex := i + rand.Intn(candidateCount-i)
-		pt := r.candidates[randomIndex]
-		r.candidates[randomIndex], r.candidates[i] = r.candidates[i], pt
-
-		score := float64(r.wins[pt]) / float64(r.hits[pt])
-		if score > bestScore {
-			bestMove = pt
-			bestScore = score
-		}
+	if best != nil {
+		bestMove = best.move
 	}
 
 	result, _ := r.makeMove(bestMove)
+	r.advanceRoot(bestMove, colorToCell(color))
+	if r.ponder {
+		r.startPondering()
+	}
 
 	if result == played {
 		x, y := r.board.getCoords(bestMove)
@@ -791,10 +1170,141 @@ func (r *robot) GenMove(color Color) (x, y int, moveResult MoveResult) {
 	panic(fmt.Sprintf("can't make generated move? %s", result))
 }
 
+// The number of moves in a row that must look hopeless before resigning,
+// if Config.ResignMoves isn't set.
+const defaultResignMoves = 3
+
+// Decides whether to resign instead of playing the best move found by the
+// search. (A single bad estimate isn't enough; the position has to look
+// hopeless for several moves in a row.)
+func (r *robot) shouldResign(color Color, best *node) bool {
+	if r.resignThreshold <= 0 || best == nil {
+		return false
+	}
+	if best.winRate() >= r.resignThreshold {
+		r.hopelessMoves[color] = 0
+		return false
+	}
+	r.hopelessMoves[color]++
+	r.log.Printf("win rate: %.3f, below resign threshold for %v moves",
+		best.winRate(), r.hopelessMoves[color])
+	return r.hopelessMoves[color] >= r.resignMoves && r.board.moveCount >= r.resignMinMove
+}
+
+// The number of playouts to run for each move when there's no time limit
+// and Config.SampleCount isn't set.
+const defaultSampleCount = 1000
+
+// Decides how long to search for the next move for the given color.
+func (r *robot) searchLimit(color Color, startTime time.Time) searchLimit {
+	limit := searchLimit{maxPlayouts: r.sampleCount}
+	budget := r.moveTime
+	if clockBudget := r.timeBudget(color); clockBudget > 0 {
+		budget = clockBudget
+	}
+	if budget > 0 {
+		limit.deadline = startTime.Add(budget)
+	} else if limit.maxPlayouts == 0 {
+		limit.maxPlayouts = defaultSampleCount
+	}
+	return limit
+}
+
 func (r *robot) GetBoardSize() int { return r.board.GetBoardSize() }
 
 func (r *robot) GetCell(x, y int) Color { return r.board.GetCell(x, y) }
 
+func (r *robot) GetKomi() float64 { return r.komi }
+
+func (r *robot) GetSetup() []Move {
+	return append([]Move(nil), r.setup...)
+}
+
+func (r *robot) GetHandicap() int { return r.handicap() }
+
+func (r *robot) SetStone(color Color, x, y int) (ok bool, message string) {
+	r.StopSearch()
+	if !r.board.checkSetStoneArgs(color, x, y) {
+		return false, "invalid args"
+	}
+	if ok, message = r.board.setStone(r.board.makePt(x, y), colorToCell(color)); !ok {
+		return false, message
+	}
+
+	// keep one entry for each stone
+	for i, m := range r.setup {
+		if m.X == x && m.Y == y {
+			r.setup = append(r.setup[:i], r.setup[i+1:]...)
+			break
+		}
+	}
+	if color != Empty {
+		r.setup = append(r.setup, Move{color, x, y})
+	}
+	r.startHash = r.board.getHash()
+	r.root = nil
+	return true, ""
+}
+
+func (r *robot) GetRules() Rules { return r.rules }
+
+func (r *robot) SetRules(rules Rules) {
+	r.StopSearch()
+	r.rules = rules
+
+	// The searchers' boards never allow suicide. It's rarely a good move,
+	// and random playouts would play it far too often.
+	r.board.suicideAllowed = rules.SuicideAllowed
+	r.scratchBoard.suicideAllowed = rules.SuicideAllowed
+
+	// the keys in seenHashes depend on the ko rule
+	r.seenHashes = make(map[uint64]int)
+	b := r.board
+	for i := 0; i < b.moveCount; i++ {
+		toPlay := WHITE
+		if b.moves[i]&WHITE_MOVE != 0 {
+			toPlay = BLACK
+		}
+		r.seenHashes[r.superkoKey(r.boardHashes[i], toPlay)]++
+	}
+	r.root = nil
+	r.ownership = nil
+}
+
+func (r *robot) GetKoRule() KoRule { return r.rules.KoRule }
+
+// Changes only the ko rule; the rest of the rules stay the same.
+func (r *robot) SetKoRule(rule KoRule) {
+	rules := r.rules
+	rules.KoRule = rule
+	r.SetRules(rules)
+}
+
+func (r *robot) GetToPlay() Color { return r.board.GetToPlay() }
+
+func (r *robot) SetToPlay(color Color) {
+	r.StopSearch()
+	if !r.board.isMyTurn(color) {
+		r.board.SetToPlay(color)
+		r.root = nil
+	}
+}
+
+func (r *robot) GetMoves() []Move {
+	b := r.board
+	moves := make([]Move, b.moveCount)
+	for i := 0; i < b.moveCount; i++ {
+		moves[i].Color = Black
+		if b.moves[i]&WHITE_MOVE != 0 {
+			moves[i].Color = White
+		}
+		if move := b.moves[i] & MOVE_TO_PT_MASK; move != PASS {
+			moves[i].X, moves[i].Y = b.getCoords(move)
+		}
+	}
+	return moves
+}
+
 // The strict version of makeMove for actually making a move.
 // (Checks for superko and updates boardHashes.)
 func (r *robot) makeMove(move pt) (result moveResult, captures int) {
@@ -803,76 +1313,66 @@ func (r *robot) makeMove(move pt) (result moveResult, captures int) {
 	}
 	result, captures = r.board.makeMove(move)
 	if !result.ok() {
-		panic(fmt.Sprintf("isLegalMove ok but makeMove returned: ", result))
+		panic(fmt.Sprintf("isLegalMove ok but makeMove returned: %v", result))
 	}
-	r.boardHashes[r.board.moveCount-1] = r.board.getHash()
+	hash := r.board.getHash()
+	r.boardHashes[r.board.moveCount-1] = hash
+	r.seenHashes[r.superkoKey(hash, r.board.toPlay)]++
 	return result, captures
 }
 
-func (r *robot) checkLegalMove(move pt) (result moveResult) {
-	// try this move on the scratch board
-	sb := r.scratchBoard
-	sb.copyFrom(r.board)
-	result, _ = sb.makeMove(move)
-
-	if result == played {
-		// check for superko
-		newHash := sb.getHash()
-		for i := 0; i < r.board.moveCount; i++ {
-			if newHash == r.boardHashes[i] {
-				// found superko
-				return superko
-			}
-		}
+// Returns the key in seenHashes for a board with the given hash and player
+// to move. Under situational superko, the same stones with a different
+// player to move are a different position.
+func (r *robot) superkoKey(hash uint64, toPlay cell) uint64 {
+	if r.rules.KoRule == SituationalSuperko && toPlay == WHITE {
+		return hash ^ zobristWhiteToPlay
 	}
-
-	return result
+	return hash
 }
 
-// Use Monte-Carlo simulation to find a win rate for each point on the board.
-// On return, r.wins[pt] will have the number of wins minus losses associated
-// with a point and r.hits[pt] will have the number of samples for that point.
-func (r *robot) findWins(numSamples int) {
-	// clear statistics
-	for i := range r.wins {
-		r.wins[i] = 0
-		r.hits[i] = 0
-	}
-
-	sb := r.scratchBoard
-	for i := 0; i < numSamples; i++ {
-		sb.copyFrom(r.board)
-		sb.playRandomGame(r.randomness)
-		score := sb.getEasyScore()
-
-		// choose amount to add to points used in this game
-		var winAmount int
-		if float64(score) > r.komi {
-			winAmount = 1
-		} else if float64(score) < r.komi {
-			winAmount = -1
-		} else {
-			winAmount = 0 // a draw
-		}
-		if r.board.getFriendlyStone() == WHITE {
-			winAmount = -winAmount
-		}
+// Returns the player to move before the first move.
+func (r *robot) startToPlay() cell {
+	b := r.board
+	if b.moveCount == 0 {
+		return b.toPlay
+	} else if b.moves[0]&WHITE_MOVE != 0 {
+		return WHITE
+	}
+	return BLACK
+}
 
-		// For each point where the first player to play was the current
-		// player, add winAmount. (All Moves As First heuristic)
-	scoring:
-		for i := r.board.moveCount; i < sb.moveCount; i += 2 {
-			pt := sb.moves[i] & MOVE_TO_PT_MASK
+// Removes one occurrence of a hash from seenHashes.
+func (r *robot) forgetHash(hash uint64) {
+	if r.seenHashes[hash] <= 1 {
+		delete(r.seenHashes, hash)
+	} else {
+		r.seenHashes[hash]--
+	}
+}
 
-			// check that it hasn't been played yet
-			for j := r.board.moveCount; j < i; j++ {
-				if sb.moves[j] == pt {
-					continue scoring
-				}
-			}
+func (r *robot) checkLegalMove(move pt) (result moveResult) {
+	// Try this move on the board and take it back, which is cheaper than
+	// copying the board. (No search is running, so nothing else reads it.)
+	b := r.board
+	result, _ = b.makeMove(move)
+	if !result.ok() {
+		return result
+	}
+	repeats := result == played && r.repeatsPosition(b)
+	b.undo()
+	if repeats {
+		return superko
+	}
+	return result
+}
 
-			r.wins[pt] += winAmount
-			r.hits[pt]++
-		}
+// Returns true if the position on a board where a move was just played
+// repeats an earlier position in the game, under the superko rule in use.
+func (r *robot) repeatsPosition(b *board) bool {
+	if r.rules.KoRule == SimpleKo {
+		return false
 	}
+	key := r.superkoKey(b.getHash(), b.toPlay)
+	return r.seenHashes[key] > 0 || key == r.superkoKey(r.startHash, r.startToPlay())
 }
@@ -3,8 +3,10 @@ package gongo
 import (
 	"fmt"
 	"log"
+	"math/rand"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestCaptureAndSuicideRules(t *testing.T) {
@@ -121,6 +123,161 @@ func TestPlayByPassing(t *testing.T) {
 ...`)
 }
 
+func TestPlaySameColorTwiceDoesNotPass(t *testing.T) {
+	r := NewRobot(3)
+	r.Play(Black, 1, 1)
+	r.Play(Black, 2, 1)
+	assertEqualsInt(t, 2, len(r.(GoRecorder).GetMoves()), "wrong number of moves")
+	if r.GetToPlay() != White {
+		t.Error("expected White to play")
+	}
+}
+
+func TestGetMoves(t *testing.T) {
+	r := NewRobot(3)
+	r.Play(Black, 1, 1)
+	r.Play(Black, 2, 2) // no pass in between
+	r.Play(White, 0, 0)
+	moves := r.(GoRecorder).GetMoves()
+	expected := []Move{{Black, 1, 1}, {Black, 2, 2}, {White, 0, 0}}
+	if len(moves) != len(expected) {
+		t.Fatalf("expected %v but got %v", expected, moves)
+	}
+	for i := range expected {
+		if moves[i] != expected[i] {
+			t.Errorf("expected %v but got %v", expected, moves)
+		}
+	}
+}
+
+func TestSetStone(t *testing.T) {
+	r := NewRobot(3)
+	setStoneLegal(t, r, Black, 2, 2, `
+...
+.@.
+...`)
+	setStoneLegal(t, r, White, 1, 1, `
+...
+.@.
+O..`)
+	setStoneLegal(t, r, Empty, 2, 2, `
+...
+...
+O..`)
+	setStoneLegal(t, r, Black, 2, 1, `
+...
+...
+O@.`)
+	// no liberties for a neighbor
+	setStoneIllegal(t, r, Black, 1, 2, `
+...
+...
+O@.`)
+	if r.GetToPlay() != Black {
+		t.Error("setup stones shouldn't change who plays next")
+	}
+	assertEqualsInt(t, 0, len(r.(GoRecorder).GetMoves()), "setup stones shouldn't be moves")
+	assertEqualsInt(t, 2, len(r.(GoRecorder).GetSetup()), "wrong number of setup stones")
+
+	playLegal(t, r, Black, 3, 3, `
+..@
+...
+O@.`)
+	setStoneIllegal(t, r, White, 2, 2, `
+..@
+...
+O@.`)
+	r.ClearBoard()
+	assertEqualsInt(t, 0, len(r.(GoRecorder).GetSetup()), "setup wasn't cleared")
+
+	// no liberties for the new stone
+	setStoneIllegal(t, NewRobot(1), Black, 1, 1, `.`)
+}
+
+func TestSetToPlay(t *testing.T) {
+	r := NewRobot(3)
+	r.SetToPlay(White)
+	playLegal(t, r, White, 2, 2, `
+...
+.O.
+...`)
+	if r.GetToPlay() != Black {
+		t.Error("expected Black to play after White's move")
+	}
+	undoLegal(t, r, `
+...
+...
+...`)
+	if r.GetToPlay() != White {
+		t.Error("expected White to play after undo")
+	}
+}
+
+func TestKoAfterSetupStones(t *testing.T) {
+	r := NewRobot(4)
+	setUpBoard(r, `
+....
+....
+.@O.
+@O.O`)
+	// the first move captures a stone
+	playLegal(t, r, Black, 3, 1, `
+....
+....
+.@O.
+@.@O`)
+	playIllegal(t, r, White, 2, 1, `
+....
+....
+.@O.
+@.@O`)
+}
+
+func TestCheckLegalMoveLeavesBoardUnchanged(t *testing.T) {
+	r := NewRobot(4).(*robot)
+	setUpBoard(r, `
+....
+....
+.@O.
+@O.O`)
+	b := r.board
+	hash := b.getFullHash()
+	if result := r.checkLegalMove(b.makePt(3, 1)); result != played {
+		t.Errorf("expected a capture to be legal but got %v", result)
+	}
+	if result := r.checkLegalMove(b.makePt(1, 2)); result != played {
+		t.Errorf("expected a move to be legal but got %v", result)
+	}
+	if b.moveCount != 0 || b.getFullHash() != hash {
+		t.Error("checking moves changed the position")
+	}
+	checkChains(t, b)
+	checkBoard(t, r, `
+....
+....
+.@O.
+@O.O`)
+}
+
+func TestSimpleKoAfterSetupStones(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 4, KoRule: SimpleKo})
+	setUpBoard(r, `
+....
+....
+.@O.
+@O.O`)
+	playLegal(t, r, Black, 3, 1, `
+....
+....
+.@O.
+@.@O`)
+	playIllegal(t, r, White, 2, 1, `
+....
+....
+.@O.
+@.@O`)
+}
+
 // example from: http://senseis.xmp.net/?SendingTwoReturningOne
 func TestDisallowPositionalSuperKo(t *testing.T) {
 	r := NewRobot(6)
@@ -154,6 +311,195 @@ OOO.O.
 ......`)
 }
 
+// With only the simple ko rule, sending two and returning one can repeat forever.
+func TestSimpleKoAllowsRepetition(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 6, KoRule: SimpleKo})
+	setUpBoard(r, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, Black, 1, 6, `
+@O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, White, 1, 4, `
+.O.@O.
+.O@@O.
+O@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, Black, 1, 5, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+}
+
+func TestSituationalSuperko(t *testing.T) {
+	r := NewRobot(6)
+	setUpBoard(r, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, Black, 1, 6, `
+@O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, White, 1, 4, `
+.O.@O.
+.O@@O.
+O@@OO.
+@@O...
+OOO.O.
+......`)
+	r.(GoKoRuleRobot).SetKoRule(SituationalSuperko)
+
+	// The starting position had Black to move; now it's White's turn.
+	playLegal(t, r, Black, 1, 5, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, White, 0, 0, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	// White would be to move, the same as after Black's first move
+	playIllegal(t, r, Black, 1, 6, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+}
+
+func TestSuicideAllowed(t *testing.T) {
+	board := `
+@@@.
+O.@.
+@@@.
+....`
+	r := NewRobot(4)
+	setUpBoard(r, board)
+	playIllegal(t, r, White, 2, 3, board)
+
+	r = NewConfiguredRobot(Config{BoardSize: 4, Rules: TrompTaylorRules})
+	setUpBoard(r, board)
+	playLegal(t, r, White, 2, 3, `
+@@@.
+..@.
+@@@.
+....`)
+	undoLegal(t, r, board)
+	if r.(*robot).board.prisoners != [3]int{} {
+		t.Error("expected no prisoners after undo")
+	}
+}
+
+func TestUndo(t *testing.T) {
+	r := NewRobot(3)
+	if r.(GoUndoRobot).Undo() {
+		t.Error("undo should fail when no moves have been played")
+	}
+	playLegal(t, r, Black, 2, 2, `
+...
+.@.
+...`)
+	playLegal(t, r, White, 1, 1, `
+...
+.@.
+O..`)
+	undoLegal(t, r, `
+...
+.@.
+...`)
+	// White is to move again
+	checkGenAnyMove(t, r, White)
+}
+
+// example from: http://senseis.xmp.net/?SendingTwoReturningOne
+func TestUndoRestoresSuperkoHistory(t *testing.T) {
+	r := NewRobot(6)
+	setUpBoard(r, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, Black, 1, 6, `
+@O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, White, 1, 4, `
+.O.@O.
+.O@@O.
+O@@OO.
+@@O...
+OOO.O.
+......`)
+	undoLegal(t, r, `
+@O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	undoLegal(t, r, `
+.O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	// replaying the same moves gives the same result
+	playLegal(t, r, Black, 1, 6, `
+@O.@O.
+@O@@O.
+.@@OO.
+@@O...
+OOO.O.
+......`)
+	playLegal(t, r, White, 1, 4, `
+.O.@O.
+.O@@O.
+O@@OO.
+@@O...
+OOO.O.
+......`)
+	playIllegal(t, r, Black, 1, 5, `
+.O.@O.
+.O@@O.
+O@@OO.
+@@O...
+OOO.O.
+......`)
+}
+
 // === move generation tests ===
 
 func TestPassWhenNoMovesLeft(t *testing.T) {
@@ -210,6 +556,74 @@ func TestGenMoveOnEachBoardSize(t *testing.T) {
 	}
 }
 
+func TestGenMoveWithThreads(t *testing.T) {
+	var c Config
+	c.BoardSize = 5
+	c.SampleCount = 200
+	c.Threads = 4
+	r := NewConfiguredRobot(c)
+	checkGenAnyMove(t, r, Black)
+	checkGenAnyMove(t, r, White)
+	checkGenAnyMove(t, r, Black)
+}
+
+func TestGenMoveWithMoveTime(t *testing.T) {
+	var c Config
+	c.BoardSize = 9
+	c.MoveTime = 50 * time.Millisecond
+	r := NewConfiguredRobot(c)
+	start := time.Now()
+	checkGenAnyMove(t, r, Black)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("took too long to generate a move: %v", elapsed)
+	}
+}
+
+func TestResignWhenHopeless(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 200,
+		ResignThreshold: 0.1, ResignMoves: 2})
+	r.SetKomi(100) // Black can't win
+	checkGenAnyMove(t, r, Black)
+	checkGenAnyMove(t, r, White)
+	if _, _, result := r.GenMove(Black); result != Resigned {
+		t.Errorf("expected Black to resign; got %v", result)
+	}
+
+	// undoing a move starts the count over
+	r.(GoUndoRobot).Undo()
+	if _, _, result := r.GenMove(White); result == Resigned {
+		t.Error("White resigned")
+	}
+	if _, _, result := r.GenMove(Black); result == Resigned {
+		t.Error("expected Black not to resign right after an undo")
+	}
+
+	// White is winning, so it never resigns
+	r.ClearBoard()
+	for i := 0; i < 3; i++ {
+		checkGenAnyMove(t, r, White)
+	}
+}
+
+func TestDontResignEarlyOrWhenTurnedOff(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 200,
+		ResignThreshold: 0.1, ResignMoves: 1, ResignMinMove: 4})
+	r.SetKomi(100)
+	checkGenAnyMove(t, r, Black)
+	checkGenAnyMove(t, r, White)
+	checkGenAnyMove(t, r, Black)
+	checkGenAnyMove(t, r, White)
+	if _, _, result := r.GenMove(Black); result != Resigned {
+		t.Errorf("expected Black to resign after the minimum move; got %v", result)
+	}
+
+	r = NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 200})
+	r.SetKomi(100)
+	for i := 0; i < 3; i++ {
+		checkGenAnyMove(t, r, Black)
+	}
+}
+
 // === test internals ===
 
 func TestGenerateAllSize1Games(t *testing.T) {
@@ -249,6 +663,56 @@ OO`)
 	assertEqualsInt(t, 544, total, "number of games changed")
 }
 
+func TestUndoRandomGames(t *testing.T) {
+	var b, before board
+	for size := 2; size <= 9; size++ {
+		b.clearBoard(size)
+		b.playRandomGame(&defaultRandomness)
+
+		// Undo each move and check that the board is the same as if we
+		// had only played the moves before it.
+		for b.moveCount > 0 {
+			before.clearBoard(size)
+			for i := 0; i < b.moveCount-1; i++ {
+				before.makeMove(b.moves[i] & MOVE_TO_PT_MASK)
+			}
+			if !b.undo() {
+				t.Fatal("undo failed")
+			}
+			checkSameBoard(t, &before, &b)
+		}
+		if b.undo() {
+			t.Error("undo should fail at the start of the game")
+		}
+	}
+}
+
+func TestZobristHash(t *testing.T) {
+	var b board
+	for size := 2; size <= 9; size++ {
+		b.clearBoard(size)
+		b.playRandomGame(&defaultRandomness)
+
+		// the incremental hash is the same as one calculated from scratch
+		var expected uint64
+		for _, pt := range b.allPoints {
+			if stone := b.cells[pt]; stone != EMPTY {
+				expected ^= zobristStones[stone][pt]
+			}
+		}
+		if b.getHash() != expected {
+			t.Errorf("hash is different from a recalculated one on size %v", size)
+		}
+	}
+
+	b.clearBoard(3)
+	empty := b.getFullHash()
+	b.toPlay = WHITE
+	if b.getFullHash() == empty || b.getHash() != 0 {
+		t.Error("expected only the full hash to depend on who plays next")
+	}
+}
+
 // TODO: enable and fix "split stack overflow" error
 func TestEasyScore(t *testing.T) {
 	log.Printf("TestEasyScore")
@@ -299,6 +763,13 @@ func playLegal(t *testing.T, r GoRobot, c Color, x, y int, expectedBoard string)
 	checkBoard(t, r, expectedBoard)
 }
 
+func undoLegal(t *testing.T, r GoRobot, expectedBoard string) {
+	if !r.(GoUndoRobot).Undo() {
+		t.Error("undo failed")
+	}
+	checkBoard(t, r, expectedBoard)
+}
+
 func playIllegal(t *testing.T, r GoRobot, c Color, x, y int, expectedBoard string) {
 	ok, message := r.Play(c, x, y)
 	if ok {
@@ -367,8 +838,8 @@ func makeBoard(boardString string) board {
 				panic("invalid character in board")
 			}
 			if !ok {
-				panic(fmt.Sprintf("couldn't place stone: ",
-					(i + 1), ",", y, ": ", message))
+				panic(fmt.Sprintf("couldn't place stone: %v,%v: %v",
+					i+1, y, message))
 			}
 		}
 	}
@@ -383,6 +854,27 @@ func checkBoard(t *testing.T, b GoBoard, expectedBoard string) {
 	}
 }
 
+// Checks that the stones, neighbor counts, and move lists of two boards are the same.
+func checkSameBoard(t *testing.T, expected, actual *board) {
+	for _, pt := range expected.allPoints {
+		if expected.cells[pt] != actual.cells[pt] ||
+			expected.neighborCounts[pt] != actual.neighborCounts[pt] {
+			t.Fatalf("boards are different. Expected:\n%v\nActual:\n%v\n",
+				BoardToString(expected), BoardToString(actual))
+		}
+	}
+	assertEqualsInt(t, expected.moveCount, actual.moveCount, "move count is different")
+	for i := 0; i < expected.moveCount; i++ {
+		if expected.moves[i] != actual.moves[i] {
+			t.Fatalf("move %v is different", i)
+		}
+	}
+	assertEqualsInt(t, expected.capturedCount, actual.capturedCount, "captured count is different")
+	if expected.hash != actual.hash {
+		t.Fatal("hash is different")
+	}
+}
+
 func trimBoard(s string) string {
 	linesIn := strings.Split(s, "\n")
 	linesOut := make([]string, len(linesIn))
@@ -397,6 +889,20 @@ func trimBoard(s string) string {
 	return strings.Join(linesOut[0:goodLines], "\n")
 }
 
+func setStoneLegal(t *testing.T, r GoRobot, c Color, x, y int, expectedBoard string) {
+	if ok, message := r.SetStone(c, x, y); !ok {
+		t.Errorf("can't set stone at %v,%v: %v", x, y, message)
+	}
+	checkBoard(t, r, expectedBoard)
+}
+
+func setStoneIllegal(t *testing.T, r GoRobot, c Color, x, y int, expectedBoard string) {
+	if ok, _ := r.SetStone(c, x, y); ok {
+		t.Errorf("expected setting a stone at %v,%v to fail", x, y)
+	}
+	checkBoard(t, r, expectedBoard)
+}
+
 func setUpBoard(r GoRobot, boardString string) {
 	boardString = trimBoard(boardString)
 	r.ClearBoard()
@@ -417,16 +923,16 @@ func setUpBoard(r GoRobot, boardString string) {
 			var message string
 			switch c {
 			case '@':
-				ok, message = r.Play(Black, i+1, y)
+				ok, message = r.SetStone(Black, i+1, y)
 			case 'O':
-				ok, message = r.Play(White, i+1, y)
+				ok, message = r.SetStone(White, i+1, y)
 			case '.':
 				ok = true
 			default:
 				panic("invalid character in board")
 			}
 			if !ok {
-				panic(fmt.Sprintf("couldn't place stone: ", message))
+				panic(fmt.Sprintf("couldn't place stone: %v", message))
 			}
 		}
 	}
@@ -524,3 +1030,77 @@ func (r *fakeRandomness) next() (hasNext bool) {
 	// we're done; tried all possibilites
 	return false
 }
+
+// === Benchmarks ===
+
+// The benchmarks use a fixed seed so that each run plays the same games.
+
+func BenchmarkPlayout9x9(bench *testing.B)        { benchmarkPlayout(bench, 9, nil) }
+func BenchmarkPlayout19x19(bench *testing.B)      { benchmarkPlayout(bench, 19, nil) }
+func BenchmarkHeavyPlayout9x9(bench *testing.B)   { benchmarkPlayout(bench, 9, heavyPolicy{}) }
+func BenchmarkHeavyPlayout19x19(bench *testing.B) { benchmarkPlayout(bench, 19, heavyPolicy{}) }
+
+func benchmarkPlayout(bench *testing.B, size int, policy playoutPolicy) {
+	var start, b board
+	start.clearBoard(size)
+	b.clearBoard(size)
+	b.policy = policy
+	random := &randomness{src: rand.NewSource(1)}
+	for i := 0; i < bench.N; i++ {
+		b.copyFrom(&start)
+		b.playRandomGame(random)
+	}
+}
+
+// Searches an empty 9x9 board and reports the playouts per second, to see
+// how well the search scales with more threads.
+func BenchmarkSearch1Thread(bench *testing.B)  { benchmarkSearch(bench, 1) }
+func BenchmarkSearch4Threads(bench *testing.B) { benchmarkSearch(bench, 4) }
+
+func benchmarkSearch(bench *testing.B, threads int) {
+	r := NewConfiguredRobot(Config{BoardSize: 9, Threads: threads}).(*robot)
+	playouts := 0
+	start := time.Now()
+	for i := 0; i < bench.N; i++ {
+		r.root = nil
+		r.prepareRoot()
+		playouts += r.search(searchLimit{maxPlayouts: 1000})
+	}
+	bench.ReportMetric(float64(playouts)/time.Since(start).Seconds(), "playouts/s")
+}
+
+// Counts the liberties of every stone in the middle of a random game.
+func BenchmarkCountLiberties(bench *testing.B) {
+	var b board
+	b.clearBoard(19)
+	b.playRandomGame(&randomness{src: rand.NewSource(1)})
+	for moveCount := b.moveCount / 2; b.moveCount > moveCount; {
+		b.undo()
+	}
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		for _, p := range b.allPoints {
+			if b.cells[p] == BLACK || b.cells[p] == WHITE {
+				b.countLiberties(p, 3)
+			}
+		}
+	}
+}
+
+// Plays and takes back each legal move in the middle of a random game.
+func BenchmarkMakeMoveAndUndo(bench *testing.B) {
+	var b board
+	b.clearBoard(19)
+	b.playRandomGame(&randomness{src: rand.NewSource(1)})
+	for moveCount := b.moveCount / 2; b.moveCount > moveCount; {
+		b.undo()
+	}
+	bench.ResetTimer()
+	for i := 0; i < bench.N; i++ {
+		for _, p := range b.allPoints {
+			if result, _ := b.makeMove(p); result == played {
+				b.undo()
+			}
+		}
+	}
+}
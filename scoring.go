@@ -0,0 +1,265 @@
+package gongo
+
+import (
+	"time"
+)
+
+// === Scoring a finished game ===
+
+// To decide which stones are dead, the robot searches the current position
+// and looks at who owns each point at the end of the playouts. Stones that
+// usually end up owned by the opponent are dead.
+
+// The fraction of playouts a player must own a point in to get it.
+const ownershipThreshold = 0.5
+
+// The fraction of playouts that ended with each point owned by each player.
+type ownership struct {
+	black, white []float64 // indexed by pt
+	playouts     int
+	root         *node // the search tree for the same playouts
+}
+
+// Returns the player who usually owns a point, or EMPTY if neither does.
+func (o *ownership) owner(p pt) cell {
+	if o.black[p] > ownershipThreshold {
+		return BLACK
+	} else if o.white[p] > ownershipThreshold {
+		return WHITE
+	}
+	return EMPTY
+}
+
+// Identifies a position, so that the ownership estimate for it can be reused.
+type positionKey struct {
+	hash      uint64 // the full hash, including who plays next
+	moveCount int
+}
+
+func (r *robot) Analyze() *Analysis {
+	r.StopSearch() // the eye check below changes b.toPlay
+	o := r.estimateOwnership()
+	b := r.board
+	a := NewAnalysis(b.size, o.playouts)
+	for _, pt := range b.allPoints {
+		x, y := b.getCoords(pt)
+		a.Black[x][y] = o.black[pt]
+		a.White[x][y] = o.white[pt]
+	}
+
+	for _, child := range o.root.children {
+		x, y := b.getCoords(child.move)
+		a.Visits[x][y] = child.visits
+		a.WinRates[x][y] = child.winRate()
+	}
+	for n := o.root.bestChild(); n != nil && n.visits > 0; n = n.bestChild() {
+		x, y := b.getCoords(n.move)
+		a.PrincipalVariation = append(a.PrincipalVariation, Move{n.color.toColor(), x, y})
+	}
+
+	// wouldFillEye checks for the player to move, so try each player
+	toPlay := b.toPlay
+	for _, pt := range b.allPoints {
+		for _, owner := range []cell{BLACK, WHITE} {
+			b.toPlay = owner
+			if b.cells[pt] == EMPTY && b.wouldFillEye(pt) {
+				x, y := b.getCoords(pt)
+				a.Eyes = append(a.Eyes, Move{owner.toColor(), x, y})
+			}
+		}
+	}
+	b.toPlay = toPlay
+
+	a.Ladders = r.findLadders()
+	return a
+}
+
+func (r *robot) GetFinalScore() float64 {
+	o := r.estimateOwnership()
+	b := r.board
+	var count pointCount
+	for _, pt := range b.allPoints {
+		owner := o.owner(pt)
+		if stone := b.cells[pt]; stone != EMPTY {
+			sign := 1
+			if stone == WHITE {
+				sign = -1
+			}
+			// as in GetStoneStatus, a stone is dead only if the opponent owns it
+			if owner == stone^3 {
+				count.deadStones -= sign
+			} else {
+				owner = stone
+				count.liveStones += sign
+			}
+		}
+		switch owner {
+		case BLACK:
+			count.area++
+		case WHITE:
+			count.area--
+		}
+	}
+	return r.score(b, count)
+}
+
+// === Scoring under different rules ===
+
+// The points counted at the end of a game, from Black's point of view
+// (that is, Black's count minus White's).
+type pointCount struct {
+	area       int // stones and surrounded points; a dead stone counts for the opponent
+	liveStones int // the stones that stay on the board
+	deadStones int // the opponent's stones that are dead, which become prisoners
+}
+
+// Returns the score from Black's point of view under the robot's rules,
+// including komi and handicap compensation.
+func (r *robot) score(b *board, count pointCount) float64 {
+	score := float64(count.area) - r.komi
+	score -= float64(r.rules.HandicapCompensation.Points(r.handicap()))
+	if r.rules.Scoring == TerritoryScoring {
+		// the stones on the board don't count, but prisoners do
+		score += float64(count.deadStones - count.liveStones + b.prisoners[WHITE] - b.prisoners[BLACK])
+		if r.rules.PassStones {
+			passes := b.countPasses()
+			score += float64(passes[WHITE] - passes[BLACK])
+		}
+	}
+	return score
+}
+
+// Returns the number of handicap stones: the black stones placed before
+// the first move, if there are at least two and no white stones.
+func (r *robot) handicap() int {
+	for _, m := range r.setup {
+		if m.Color != Black {
+			return 0
+		}
+	}
+	if len(r.setup) < 2 {
+		return 0
+	}
+	return len(r.setup)
+}
+
+// Returns the number of times each player has passed (indexed by cell).
+func (b *board) countPasses() (passes [3]int) {
+	for i := 0; i < b.moveCount; i++ {
+		if b.moves[i]&MOVE_TO_PT_MASK == PASS {
+			if b.moves[i]&WHITE_MOVE != 0 {
+				passes[WHITE]++
+			} else {
+				passes[BLACK]++
+			}
+		}
+	}
+	return passes
+}
+
+func (r *robot) GetStoneStatus(x, y int) StoneStatus {
+	r.StopSearch()
+	b := r.board
+	p := b.makePt(x, y)
+	stone := b.cells[p]
+	if stone == EMPTY {
+		return Alive // not a stone; nothing to remove
+	}
+
+	o := r.estimateOwnership()
+	if o.owner(p) == stone^3 {
+		return Dead
+	}
+
+	if r.inSeki(p, o) {
+		return Seki
+	}
+	return Alive
+}
+
+// Returns true if the chain containing the given live stone shares a liberty
+// that neither player gets with a live enemy chain, and both chains are so
+// short of liberties that whoever fills it puts their own chain in atari.
+// (A live chain next to dame isn't in seki; the dame can be filled safely.)
+func (r *robot) inSeki(target pt, o *ownership) bool {
+	b := r.board
+	libertyCount, _ := b.countLiberties(target, 3)
+	if libertyCount > 2 {
+		return false
+	}
+	liberties := [2]pt{b.liberties[0], b.liberties[1]}
+
+	enemyStone := b.cells[target] ^ 3
+	for _, liberty := range liberties[:libertyCount] {
+		if o.owner(liberty) != EMPTY {
+			continue
+		}
+		for dir := 0; dir < 4; dir++ {
+			neighbor := liberty + b.dirOffset[dir]
+			if b.cells[neighbor] == enemyStone && o.owner(neighbor) == enemyStone && b.libertyCount(neighbor) <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Searches the current position to find out who owns each point at the end
+// of the game. The result is saved until the position changes.
+func (r *robot) estimateOwnership() *ownership {
+	r.StopSearch()
+	key := positionKey{r.board.getFullHash(), r.board.moveCount}
+	if r.ownership != nil && r.ownershipKey == key {
+		return r.ownership
+	}
+
+	// The tree may already be decided from an earlier search, but the
+	// ownership counts only come from this one, so it runs every playout.
+	r.prepareRoot()
+	limit := searchLimit{maxPlayouts: r.sampleCount, allPlayouts: true}
+	if limit.maxPlayouts == 0 {
+		limit.maxPlayouts = defaultSampleCount
+	}
+	if r.moveTime > 0 {
+		limit.deadline = time.Now().Add(r.moveTime)
+	}
+	r.search(limit)
+
+	r.ownership = r.collectOwnership()
+	r.ownership.root = r.root
+	r.ownershipKey = key
+	return r.ownership
+}
+
+// Combines the ownership counts from each searcher after a search.
+func (r *robot) collectOwnership() *ownership {
+	size := len(r.board.cells)
+	o := &ownership{black: make([]float64, size), white: make([]float64, size)}
+	playouts := 0
+	for _, s := range r.searchers {
+		playouts += s.playouts
+		for _, pt := range r.board.allPoints {
+			o.black[pt] += float64(s.blackOwned[pt])
+			o.white[pt] += float64(s.whiteOwned[pt])
+		}
+	}
+	o.playouts = playouts
+	if playouts == 0 {
+		// The search ran out of time before any playouts finished, so count
+		// the board as it is, with every stone alive.
+		for _, pt := range r.board.allPoints {
+			switch r.board.getEasyOwner(pt) {
+			case BLACK:
+				o.black[pt] = 1
+			case WHITE:
+				o.white[pt] = 1
+			}
+		}
+		return o
+	}
+	for _, pt := range r.board.allPoints {
+		o.black[pt] /= float64(playouts)
+		o.white[pt] /= float64(playouts)
+	}
+	return o
+}
@@ -0,0 +1,300 @@
+package gongo
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFinalScoreRemovesDeadStones(t *testing.T) {
+	r := NewRobot(5)
+	r.SetKomi(0.5)
+	setUpBoard(r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+	scorer := r.(GoScorer)
+	if score := scorer.GetFinalScore(); score != -5.5 {
+		t.Errorf("expected W+5.5 but got %v", score)
+	}
+	checkStatus(t, scorer, 4, 1, Dead)
+	checkStatus(t, scorer, 2, 1, Alive)
+	checkStatus(t, scorer, 3, 1, Alive)
+	// scoring doesn't change the board
+	checkBoard(t, r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+}
+
+func TestInSeki(t *testing.T) {
+	// The black stones in the corner and the white stones around them share
+	// two liberties; whoever fills one gets captured. (Random playouts don't
+	// always see this, so each stone is given to its own color here.)
+	r := NewRobot(7).(*robot)
+	setUpBoard(r, `
+@.O@...
+@.O@...
+@@O@...
+OOO@...
+@@@@...
+.......
+.......`)
+	b := r.board
+	o := &ownership{black: make([]float64, len(b.cells)), white: make([]float64, len(b.cells))}
+	for _, p := range b.allPoints {
+		switch b.cells[p] {
+		case BLACK:
+			o.black[p] = 1
+		case WHITE:
+			o.white[p] = 1
+		}
+	}
+	for _, c := range []struct {
+		x, y     int
+		expected bool
+	}{
+		{1, 7, true},
+		{3, 7, true},
+		{4, 7, false}, // touches the white chain, but has plenty of liberties
+	} {
+		if actual := r.inSeki(b.makePt(c.x, c.y), o); actual != c.expected {
+			t.Errorf("expected in seki at (%v,%v) to be %v", c.x, c.y, c.expected)
+		}
+	}
+}
+
+func TestStatusAgreesWithScoreForNeutralStones(t *testing.T) {
+	r := NewRobot(5).(*robot)
+	r.SetKomi(0.5)
+	setUpBoard(r, `
+.....
+.....
+.@...
+.....
+...O.`)
+	// Neither player usually owns the black stone; White owns the white one.
+	b := r.board
+	o := &ownership{black: make([]float64, len(b.cells)), white: make([]float64, len(b.cells))}
+	o.black[b.makePt(2, 3)] = 0.5
+	o.white[b.makePt(2, 3)] = 0.5
+	o.white[b.makePt(4, 1)] = 1
+	r.ownership = o
+	r.ownershipKey = positionKey{b.getFullHash(), b.moveCount}
+
+	checkStatus(t, r, 2, 3, Alive)
+	checkStatus(t, r, 4, 1, Alive)
+	// both stones are counted, so the score is 1 - 1 - 0.5
+	if score := r.GetFinalScore(); score != -0.5 {
+		t.Errorf("expected W+0.5 but got %v", score)
+	}
+}
+
+func TestStoneStatusNextToDame(t *testing.T) {
+	// the points between the groups are dame, but neither group is in seki
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 1000})
+	setUpBoard(r, `
+.@.O.
+.@.O.
+.@.O.
+.@.O.
+.@.O.`)
+	scorer := r.(GoScorer)
+	checkStatus(t, scorer, 2, 3, Alive)
+	checkStatus(t, scorer, 4, 3, Alive)
+}
+
+func TestFinalScoreUnderTerritoryScoring(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, Rules: JapaneseRules})
+	r.SetKomi(0.5)
+	setUpBoard(r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+	// Black has 4 points; White has 8 points and a dead stone.
+	if score := r.(GoScorer).GetFinalScore(); score != -5.5 {
+		t.Errorf("expected W+5.5 but got %v", score)
+	}
+}
+
+func TestScoreUnderRules(t *testing.T) {
+	r := NewRobot(5).(*robot)
+	r.SetKomi(0.5)
+	count := pointCount{area: 5, liveStones: 3, deadStones: 1}
+	checkScore := func(rules Rules, expected float64) {
+		r.SetRules(rules)
+		if score := r.score(r.board, count); score != expected {
+			t.Errorf("expected %v under %v but got %v", expected, rules, score)
+		}
+	}
+	checkScore(ChineseRules, 4.5)
+	checkScore(JapaneseRules, 2.5)
+
+	// prisoners count under territory scoring
+	r.board.prisoners[WHITE] = 2
+	checkScore(TrompTaylorRules, 4.5)
+	checkScore(JapaneseRules, 4.5)
+
+	// a handicap of three stones
+	for x := 1; x <= 3; x++ {
+		r.SetStone(Black, x, 1)
+	}
+	checkScore(ChineseRules, 1.5) // 5 - 0.5 - 3
+	checkScore(AGARules, 2.5)     // 5 - 0.5 - 2
+	checkScore(JapaneseRules, 4.5)
+
+	// with pass stones, White's pass is a prisoner for Black
+	r.Play(White, 0, 0)
+	checkScore(JapaneseRules, 4.5)
+	checkScore(Rules{Scoring: TerritoryScoring, PassStones: true}, 5.5)
+	checkScore(AGARules, 2.5) // passes don't matter under area scoring
+}
+
+func TestOwnershipIsSavedUntilPositionChanges(t *testing.T) {
+	r := NewRobot(5).(*robot)
+	first := r.estimateOwnership()
+	if r.estimateOwnership() != first {
+		t.Error("ownership should be reused for the same position")
+	}
+	r.Play(Black, 3, 3)
+	if r.estimateOwnership() == first {
+		t.Error("ownership should be estimated again after a move")
+	}
+}
+
+func TestOwnershipAfterDecidedSearch(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100}).(*robot)
+	setUpBoard(r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+	// a long earlier search has already decided the best move
+	r.prepareRoot()
+	r.root.children[0].visits = 100000
+	r.root.visits = 100000
+	if o := r.estimateOwnership(); o.playouts != 100 {
+		t.Errorf("expected 100 playouts but got %v", o.playouts)
+	}
+	checkStatus(t, r, 4, 1, Dead)
+	checkStatus(t, r, 2, 1, Alive)
+}
+
+func TestOwnershipWithoutPlayouts(t *testing.T) {
+	r := NewRobot(5).(*robot)
+	setUpBoard(r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+	for _, s := range r.searchers {
+		s.reset()
+	}
+	o := r.collectOwnership()
+	b := r.board
+	for _, c := range []struct {
+		x, y  int
+		owner cell
+	}{
+		{1, 5, BLACK},
+		{4, 1, BLACK}, // every stone is alive
+		{5, 3, WHITE},
+		{5, 5, EMPTY},
+	} {
+		if actual := o.owner(b.makePt(c.x, c.y)); actual != c.owner {
+			t.Errorf("expected (%v,%v) to be owned by %v but got %v", c.x, c.y, c.owner, actual)
+		}
+	}
+}
+
+// Run with -race to check that scoring doesn't share the board with the
+// search in the background.
+func TestScoringStopsPondering(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100, Ponder: true}).(*robot)
+	scorers := []func(){
+		func() { r.GetFinalScore() },
+		func() { r.GetStoneStatus(3, 3) },
+		func() { r.Analyze() },
+	}
+	for i, score := range scorers {
+		checkGenAnyMove(t, r, Black)
+		if r.background == nil {
+			t.Fatal("expected a search in the background")
+		}
+		score()
+		if r.background != nil {
+			t.Errorf("scorer %v didn't stop the search", i)
+		}
+		r.ClearBoard()
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	r := NewRobot(5)
+	setUpBoard(r, `
+.@O..
+.@O..
+@@O.O
+.@OO.
+.@O@.`)
+	a := r.(GoAnalyzer).Analyze()
+	assertEqualsInt(t, 5, a.Size, "wrong size")
+	if a.Playouts == 0 {
+		t.Error("expected some playouts")
+	}
+	if a.Black[1][5] < 0.9 {
+		t.Errorf("expected Black to own A5; got %v", a.Black[1][5])
+	}
+	if a.White[4][1] < 0.5 {
+		t.Errorf("expected the dead stone at D1 to be White's; got %v", a.White[4][1])
+	}
+	totalVisits := 0
+	for x := 1; x <= 5; x++ {
+		for y := 1; y <= 5; y++ {
+			if neutral := a.Neutral(x, y); neutral < -1e-9 || neutral > 1+1e-9 {
+				t.Errorf("invalid neutral fraction at (%v,%v): %v", x, y, neutral)
+			}
+			if a.Visits[x][y] > 0 && r.GetCell(x, y) != Empty {
+				t.Errorf("occupied point (%v,%v) was searched", x, y)
+			}
+			totalVisits += a.Visits[x][y]
+		}
+	}
+	if totalVisits == 0 {
+		t.Error("expected some visits")
+	}
+	if len(a.PrincipalVariation) == 0 || a.PrincipalVariation[0].Color != Black {
+		t.Errorf("expected a principal variation starting with Black: %v", a.PrincipalVariation)
+	}
+
+	if len(a.Eyes) != 0 {
+		t.Errorf("expected no eyes but got %v", a.Eyes)
+	}
+}
+
+func TestAnalyzeFindsEyes(t *testing.T) {
+	r := NewRobot(4)
+	setUpBoard(r, `
+.@..
+@@..
+...O
+..O.`)
+	a := r.(GoAnalyzer).Analyze()
+	expected := []Move{{White, 4, 1}, {Black, 1, 4}}
+	if fmt.Sprint(a.Eyes) != fmt.Sprint(expected) {
+		t.Errorf("expected eyes %v but got %v", expected, a.Eyes)
+	}
+}
+
+func checkStatus(t *testing.T, scorer GoScorer, x, y int, expected StoneStatus) {
+	if actual := scorer.GetStoneStatus(x, y); actual != expected {
+		t.Errorf("expected stone at (%v,%v) to be %v but it's %v", x, y, expected, actual)
+	}
+}
@@ -0,0 +1,310 @@
+package sgf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/skybrian/Gongo"
+)
+
+// === Go games ===
+
+// A Game is the main line of a game tree, interpreted as a game of Go.
+type Game struct {
+	Size     int
+	Komi     float64
+	Handicap int    // informational; the handicap stones are in Setup
+	Result   string // for example "B+R" or "W+2.5"; empty if unknown
+
+	// Stones placed on the board before the first move (the AB and AW
+	// properties of the root node). Passes aren't allowed.
+	Setup []gongo.Move
+
+	// The player to move after the setup stones are placed (the PL property),
+	// or Empty if not specified. Normally the first move says who plays
+	// first; this is for positions where no moves have been played.
+	ToPlay gongo.Color
+
+	// The moves played, in order. (0,0) means a pass.
+	Moves []gongo.Move
+}
+
+// The board size to use when a game doesn't have an SZ property.
+const defaultSize = 19
+
+// Interprets the main line of a game tree as a game of Go.
+func NewGame(tree *GameTree) (*Game, error) {
+	nodes := tree.MainLine()
+	root := nodes[0]
+	g := &Game{Size: defaultSize}
+
+	if value, ok := root.Get("GM"); ok && value != "1" {
+		return nil, fmt.Errorf("sgf: not a game of Go (GM[%v])", value)
+	}
+	if value, ok := root.Get("SZ"); ok {
+		size, err := strconv.Atoi(value)
+		if err != nil || size < 1 || size > gongo.MaxBoardSize {
+			return nil, fmt.Errorf("sgf: unsupported board size: %v", value)
+		}
+		g.Size = size
+	}
+	if value, ok := root.Get("KM"); ok && value != "" {
+		komi, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("sgf: invalid komi: %v", value)
+		}
+		g.Komi = komi
+	}
+	if value, ok := root.Get("HA"); ok && value != "" {
+		handicap, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("sgf: invalid handicap: %v", value)
+		}
+		g.Handicap = handicap
+	}
+	g.Result, _ = root.Get("RE")
+	if value, ok := root.Get("PL"); ok {
+		switch strings.ToUpper(value) {
+		case "B":
+			g.ToPlay = gongo.Black
+		case "W":
+			g.ToPlay = gongo.White
+		default:
+			return nil, fmt.Errorf("sgf: invalid player: %v", value)
+		}
+	}
+
+	for i, node := range nodes {
+		for _, p := range node.Properties {
+			var color gongo.Color
+			switch p.ID {
+			case "B", "AB":
+				color = gongo.Black
+			case "W", "AW":
+				color = gongo.White
+			case "AE":
+				// Nothing to remove before the first move. Later on, we have
+				// no way to take a stone off the board.
+				if i == 0 {
+					continue
+				}
+				return nil, fmt.Errorf("sgf: AE after the first move isn't supported")
+			default:
+				continue
+			}
+
+			if p.ID == "B" || p.ID == "W" {
+				if len(p.Values) != 1 {
+					return nil, fmt.Errorf("sgf: expected one value for %v", p.ID)
+				}
+				x, y, err := g.parseMove(p.Values[0])
+				if err != nil {
+					return nil, err
+				}
+				g.Moves = append(g.Moves, gongo.Move{Color: color, X: x, Y: y})
+				continue
+			}
+
+			// AB or AW
+			if i != 0 {
+				return nil, fmt.Errorf("sgf: %v after the first move isn't supported", p.ID)
+			}
+			for _, value := range p.Values {
+				points, err := g.parsePoints(value)
+				if err != nil {
+					return nil, err
+				}
+				for _, pt := range points {
+					g.Setup = append(g.Setup, gongo.Move{Color: color, X: pt[0], Y: pt[1]})
+				}
+			}
+		}
+	}
+	return g, nil
+}
+
+// Reads the first game in an SGF file.
+func ReadGame(input io.Reader) (*Game, error) {
+	trees, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return NewGame(trees[0])
+}
+
+// Records the game that a robot is playing. If the robot implements
+// gongo.GoRecorder, the game includes komi, the handicap, the setup stones,
+// and each move played. Otherwise, the stones on the board are recorded as
+// setup stones.
+func Record(robot gongo.GoRobot) *Game {
+	g := &Game{Size: robot.GetBoardSize(), ToPlay: robot.GetToPlay()}
+	if recorder, ok := robot.(gongo.GoRecorder); ok {
+		g.Komi = recorder.GetKomi()
+		g.Handicap = recorder.GetHandicap()
+		g.Setup = recorder.GetSetup()
+		g.Moves = recorder.GetMoves()
+		if len(g.Moves) > 0 {
+			g.ToPlay = gongo.Empty // the first move says who plays first
+		}
+		return g
+	}
+	for y := g.Size; y >= 1; y-- {
+		for x := 1; x <= g.Size; x++ {
+			if color := robot.GetCell(x, y); color != gongo.Empty {
+				g.Setup = append(g.Setup, gongo.Move{Color: color, X: x, Y: y})
+			}
+		}
+	}
+	return g
+}
+
+// Sets up a robot to play this game: clears the board, sets the board size
+// and komi, places the setup stones, and plays the first moveLimit moves.
+// The setup stones aren't moves, so they can't be undone.
+// If moveLimit is negative, all the moves are played.
+func (g *Game) Replay(robot gongo.GoRobot, moveLimit int) error {
+	if !robot.SetBoardSize(g.Size) {
+		return fmt.Errorf("sgf: robot doesn't support board size %v", g.Size)
+	}
+	robot.ClearBoard()
+	robot.SetKomi(g.Komi)
+
+	moves := g.Moves
+	if moveLimit >= 0 && moveLimit < len(moves) {
+		moves = moves[:moveLimit]
+	}
+	for _, m := range g.Setup {
+		if ok, message := robot.SetStone(m.Color, m.X, m.Y); !ok {
+			return fmt.Errorf("sgf: can't place setup stone at %v: %v", g.formatPoint(m.X, m.Y), message)
+		}
+	}
+	if g.ToPlay != gongo.Empty {
+		robot.SetToPlay(g.ToPlay)
+	}
+	for i, m := range moves {
+		if ok, message := robot.Play(m.Color, m.X, m.Y); !ok {
+			return fmt.Errorf("sgf: illegal move %v at %v: %v", i+1, g.formatPoint(m.X, m.Y), message)
+		}
+	}
+	return nil
+}
+
+// Converts the game to a game tree with one node per move.
+func (g *Game) Tree() *GameTree {
+	root := new(Node)
+	root.Add("FF", "4")
+	root.Add("GM", "1")
+	root.Add("AP", "Gongo")
+	root.Add("SZ", strconv.Itoa(g.Size))
+	root.Add("KM", strconv.FormatFloat(g.Komi, 'f', -1, 64))
+	if g.Handicap > 0 {
+		root.Add("HA", strconv.Itoa(g.Handicap))
+	}
+	if g.Result != "" {
+		root.Add("RE", g.Result)
+	}
+	// PL is only needed if it's not the player who moves first
+	firstPlayer := gongo.Black
+	if len(g.Moves) > 0 {
+		firstPlayer = g.Moves[0].Color
+	}
+	if g.ToPlay != gongo.Empty && g.ToPlay != firstPlayer {
+		root.Add("PL", colorID(g.ToPlay))
+	}
+	for _, color := range []gongo.Color{gongo.Black, gongo.White} {
+		var points []string
+		for _, m := range g.Setup {
+			if m.Color == color {
+				points = append(points, g.formatPoint(m.X, m.Y))
+			}
+		}
+		if len(points) > 0 {
+			root.Add("A"+colorID(color), points...)
+		}
+	}
+
+	tree := &GameTree{Nodes: []*Node{root}}
+	for _, m := range g.Moves {
+		node := new(Node)
+		node.Add(colorID(m.Color), g.formatPoint(m.X, m.Y))
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	return tree
+}
+
+// Writes the game in SGF format.
+func (g *Game) Write(out io.Writer) error {
+	if err := g.Tree().Write(out); err != nil {
+		return err
+	}
+	_, err := io.WriteString(out, "\n")
+	return err
+}
+
+func colorID(c gongo.Color) string {
+	if c == gongo.White {
+		return "W"
+	}
+	return "B"
+}
+
+// === Points ===
+
+// SGF writes a point as two letters, column then row, where "aa" is the
+// top left corner. A pass is an empty value, or "tt" on boards up to 19x19.
+
+func (g *Game) parseMove(value string) (x, y int, err error) {
+	if value == "" || (value == "tt" && g.Size <= 19) {
+		return 0, 0, nil
+	}
+	return g.parsePoint(value)
+}
+
+func (g *Game) parsePoint(value string) (x, y int, err error) {
+	if len(value) != 2 {
+		return 0, 0, fmt.Errorf("sgf: invalid point: %v", value)
+	}
+	col, row := int(value[0]-'a'), int(value[1]-'a')
+	if col < 0 || col >= g.Size || row < 0 || row >= g.Size {
+		return 0, 0, fmt.Errorf("sgf: point not on the board: %v", value)
+	}
+	return col + 1, g.Size - row, nil
+}
+
+// Parses a point or a compressed rectangle of points ("aa:cc").
+func (g *Game) parsePoints(value string) ([][2]int, error) {
+	first, last := value, value
+	if i := strings.Index(value, ":"); i >= 0 {
+		first, last = value[:i], value[i+1:]
+	}
+	x1, y1, err := g.parsePoint(first)
+	if err != nil {
+		return nil, err
+	}
+	x2, y2, err := g.parsePoint(last)
+	if err != nil {
+		return nil, err
+	}
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	if y1 < y2 {
+		y1, y2 = y2, y1
+	}
+	var points [][2]int
+	for y := y1; y >= y2; y-- {
+		for x := x1; x <= x2; x++ {
+			points = append(points, [2]int{x, y})
+		}
+	}
+	return points, nil
+}
+
+func (g *Game) formatPoint(x, y int) string {
+	if x == 0 && y == 0 {
+		return ""
+	}
+	return string([]byte{byte('a' + x - 1), byte('a' + g.Size - y)})
+}
@@ -0,0 +1,192 @@
+package sgf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/skybrian/Gongo"
+)
+
+func readGame(t *testing.T, input string) *Game {
+	g, err := ReadGame(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestNewGame(t *testing.T) {
+	g := readGame(t, "(;GM[1]SZ[5]KM[0.5]HA[2]RE[W+R]AB[aa][ee]AW[bb:cc];W[cd];B[];W[tt])")
+	if g.Size != 5 || g.Komi != 0.5 || g.Handicap != 2 || g.Result != "W+R" {
+		t.Errorf("wrong game info: %+v", g)
+	}
+	expectedSetup := []gongo.Move{
+		{Color: gongo.Black, X: 1, Y: 5},
+		{Color: gongo.Black, X: 5, Y: 1},
+		{Color: gongo.White, X: 2, Y: 4},
+		{Color: gongo.White, X: 3, Y: 4},
+		{Color: gongo.White, X: 2, Y: 3},
+		{Color: gongo.White, X: 3, Y: 3},
+	}
+	checkMoves(t, "setup", expectedSetup, g.Setup)
+	expectedMoves := []gongo.Move{
+		{Color: gongo.White, X: 3, Y: 2},
+		{Color: gongo.Black},
+		{Color: gongo.White},
+	}
+	checkMoves(t, "moves", expectedMoves, g.Moves)
+}
+
+func TestNewGameDefaults(t *testing.T) {
+	g := readGame(t, "(;B[dd])")
+	if g.Size != 19 || g.Komi != 0 {
+		t.Errorf("wrong defaults: %+v", g)
+	}
+}
+
+func TestNewGameErrors(t *testing.T) {
+	for _, input := range []string{
+		"(;GM[2])",
+		"(;SZ[30])",
+		"(;SZ[9:13])",
+		"(;KM[x])",
+		"(;SZ[9];B[jj])",
+		"(;SZ[9];B[aa];AB[bb])",
+		"(;SZ[9];B[aa];AE[aa])",
+	} {
+		if _, err := ReadGame(strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	g := readGame(t, "(;SZ[3]KM[1.5]AB[aa];W[bb];B[ab];W[])")
+	robot := gongo.NewRobot(9)
+	if err := g.Replay(robot, -1); err != nil {
+		t.Fatal(err)
+	}
+	checkBoard(t, robot, `
+@..
+@O.
+...`)
+
+	if err := g.Replay(robot, 1); err != nil {
+		t.Fatal(err)
+	}
+	checkBoard(t, robot, `
+@..
+.O.
+...`)
+
+	g = readGame(t, "(;SZ[3];B[aa];W[aa])")
+	if err := g.Replay(robot, -1); err == nil {
+		t.Error("expected an error for an illegal move")
+	}
+}
+
+func TestRecordAndWrite(t *testing.T) {
+	robot := gongo.NewRobot(3)
+	robot.SetKomi(0.5)
+	robot.Play(gongo.Black, 1, 3)
+	robot.Play(gongo.White, 2, 2)
+	robot.Play(gongo.Black, 0, 0)
+
+	var out bytes.Buffer
+	if err := Record(robot).Write(&out); err != nil {
+		t.Fatal(err)
+	}
+	expected := "(;FF[4]GM[1]AP[Gongo]SZ[3]KM[0.5]\n;B[aa];W[bb];B[])\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, out.String())
+	}
+
+	g := readGame(t, out.String())
+	if err := g.Replay(gongo.NewRobot(9), -1); err != nil {
+		t.Fatal(err)
+	}
+	checkMoves(t, "moves", Record(robot).Moves, g.Moves)
+}
+
+func TestSetupAndPlayerToMove(t *testing.T) {
+	g := readGame(t, "(;SZ[3]HA[2]AB[aa][cc]PL[W])")
+	if g.ToPlay != gongo.White {
+		t.Errorf("expected White to play but got %v", g.ToPlay)
+	}
+	robot := gongo.NewRobot(9)
+	if err := g.Replay(robot, -1); err != nil {
+		t.Fatal(err)
+	}
+	checkBoard(t, robot, `
+@..
+...
+..@`)
+	if robot.GetToPlay() != gongo.White {
+		t.Error("expected White to play after replay")
+	}
+	if moves := robot.(gongo.GoRecorder).GetMoves(); len(moves) != 0 {
+		t.Errorf("setup stones shouldn't be moves: %v", moves)
+	}
+
+	var out bytes.Buffer
+	Record(robot).Write(&out)
+	expected := "(;FF[4]GM[1]AP[Gongo]SZ[3]KM[0]HA[2]PL[W]AB[aa][cc])\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%v\nbut got:\n%v", expected, out.String())
+	}
+}
+
+// A robot that doesn't implement GoRecorder.
+type boardOnly struct {
+	gongo.GoRobot
+}
+
+func TestRecordStones(t *testing.T) {
+	robot := gongo.NewRobot(3)
+	robot.Play(gongo.Black, 1, 3)
+	robot.Play(gongo.White, 2, 2)
+	g := Record(boardOnly{robot})
+	expected := []gongo.Move{
+		{Color: gongo.Black, X: 1, Y: 3},
+		{Color: gongo.White, X: 2, Y: 2},
+	}
+	checkMoves(t, "setup", expected, g.Setup)
+	if len(g.Moves) != 0 {
+		t.Errorf("expected no moves but got %v", g.Moves)
+	}
+}
+
+func checkMoves(t *testing.T, name string, expected, actual []gongo.Move) {
+	if len(expected) != len(actual) {
+		t.Errorf("%v: expected %v but got %v", name, expected, actual)
+		return
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Errorf("%v: expected %v but got %v", name, expected, actual)
+			return
+		}
+	}
+}
+
+func checkBoard(t *testing.T, robot gongo.GoRobot, expected string) {
+	var out bytes.Buffer
+	size := robot.GetBoardSize()
+	for y := size; y >= 1; y-- {
+		out.WriteString("\n")
+		for x := 1; x <= size; x++ {
+			switch robot.GetCell(x, y) {
+			case gongo.Black:
+				out.WriteString("@")
+			case gongo.White:
+				out.WriteString("O")
+			default:
+				out.WriteString(".")
+			}
+		}
+	}
+	if out.String() != expected {
+		t.Errorf("expected board:%v\nbut got:%v", expected, out.String())
+	}
+}
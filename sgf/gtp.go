@@ -0,0 +1,81 @@
+package sgf
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skybrian/Gongo"
+)
+
+// === GTP commands ===
+
+// Importing this package adds the loadsgf and printsgf commands to the GTP
+// driver (gongo.Run).
+
+func init() {
+	gongo.RegisterCommand("loadsgf", loadsgf)
+	gongo.RegisterCommand("printsgf", printsgf)
+}
+
+// loadsgf <file> [move_number]
+// Replays the main line of a game on a cleared board. If a move number is
+// given, stops at the position before that move is played (counting from 1).
+func loadsgf(robot gongo.GoRobot, args []string) (string, bool) {
+	if len(args) < 1 || len(args) > 2 {
+		return "wrong number of arguments", false
+	}
+
+	moveLimit := -1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return "syntax error", false
+		}
+		moveLimit = n - 1
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return "cannot load file", false
+	}
+	defer file.Close()
+
+	g, err := ReadGame(file)
+	if err != nil {
+		return "cannot load file: " + err.Error(), false
+	}
+	if err = g.Replay(robot, moveLimit); err != nil {
+		return "cannot load file: " + err.Error(), false
+	}
+	return "", true
+}
+
+// printsgf [file]
+// Writes the current game to the given file, or returns it if no file is given.
+func printsgf(robot gongo.GoRobot, args []string) (string, bool) {
+	if len(args) > 1 {
+		return "wrong number of arguments", false
+	}
+
+	g := Record(robot)
+	if len(args) == 0 {
+		var out bytes.Buffer
+		g.Write(&out)
+		return strings.TrimSpace(out.String()), true
+	}
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return "cannot save file", false
+	}
+	err = g.Write(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "cannot save file", false
+	}
+	return "", true
+}
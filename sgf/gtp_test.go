@@ -0,0 +1,59 @@
+package sgf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skybrian/Gongo"
+)
+
+func TestLoadSgf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sgf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "game.sgf")
+	if err := ioutil.WriteFile(file, []byte("(;SZ[3]KM[0.5]AB[aa];W[bb];B[cc])"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	robot := gongo.NewRobot(9)
+	checkGtp(t, robot, "loadsgf "+file+" 2\nshowboard\n", "= \n\n= @..\n.O.\n...\n\n")
+	checkGtp(t, robot, "loadsgf "+file+"\nshowboard\n", "= \n\n= @..\n.O.\n..@\n\n")
+	checkGtp(t, robot, "loadsgf "+file+" 0\n", "? syntax error\n\n")
+	checkGtp(t, robot, "loadsgf "+filepath.Join(dir, "missing.sgf")+"\n", "? cannot load file\n\n")
+}
+
+func TestPrintSgf(t *testing.T) {
+	robot := gongo.NewRobot(3)
+	robot.Play(gongo.Black, 2, 2)
+	checkGtp(t, robot, "printsgf\n", "= (;FF[4]GM[1]AP[Gongo]SZ[3]KM[0]\n;B[bb])\n\n")
+
+	dir, err := ioutil.TempDir("", "sgf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "game.sgf")
+	checkGtp(t, robot, "printsgf "+file+"\n", "= \n\n")
+	saved, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(saved) != "(;FF[4]GM[1]AP[Gongo]SZ[3]KM[0]\n;B[bb])\n" {
+		t.Errorf("unexpected file contents: %q", saved)
+	}
+}
+
+func checkGtp(t *testing.T, robot gongo.GoRobot, input, expected string) {
+	var out bytes.Buffer
+	gongo.Run(robot, bytes.NewBufferString(input+"quit\n"), &out)
+	expected += "= \n\n"
+	if out.String() != expected {
+		t.Errorf("input:\n%v\nexpected:\n%q\nbut got:\n%q", input, expected, out.String())
+	}
+}
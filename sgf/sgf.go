@@ -0,0 +1,316 @@
+// The sgf package reads and writes Go games in Smart Game Format (FF[4]),
+// which is the usual format for archiving games and sharing them
+// between programs. [1]
+//
+// The lower level of this package parses an SGF file into game trees,
+// made up of nodes with properties, and writes them back out. The higher
+// level (see Game) interprets the main line of a game tree as a Go game
+// that can be replayed on a GoRobot.
+//
+// [1] http://www.red-bean.com/sgf/
+package sgf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// === Game trees ===
+
+// A property of a node, such as B[dd] (a black move) or KM[6.5] (komi).
+// Most properties have one value; some, such as AB (add black stones),
+// can have a list of values.
+type Property struct {
+	ID     string
+	Values []string
+}
+
+// A node holds the properties for one move, or for setting up a position.
+type Node struct {
+	Properties []Property
+}
+
+// Returns the first value of a property, if the node has it.
+func (n *Node) Get(id string) (value string, ok bool) {
+	for _, p := range n.Properties {
+		if p.ID == id && len(p.Values) > 0 {
+			return p.Values[0], true
+		}
+	}
+	return "", false
+}
+
+// Returns all values of a property, or nil if the node doesn't have it.
+func (n *Node) GetAll(id string) []string {
+	for _, p := range n.Properties {
+		if p.ID == id {
+			return p.Values
+		}
+	}
+	return nil
+}
+
+// Adds a property to the node.
+func (n *Node) Add(id string, values ...string) {
+	n.Properties = append(n.Properties, Property{id, values})
+}
+
+// A game tree is a sequence of nodes followed by any number of variations.
+// The first variation continues the main line.
+type GameTree struct {
+	Nodes      []*Node
+	Variations []*GameTree
+}
+
+// Returns the nodes in the main line of the game: the nodes of this tree,
+// then the nodes of its first variation, and so on.
+func (t *GameTree) MainLine() []*Node {
+	var nodes []*Node
+	for ; t != nil; t = firstVariation(t) {
+		nodes = append(nodes, t.Nodes...)
+	}
+	return nodes
+}
+
+func firstVariation(t *GameTree) *GameTree {
+	if len(t.Variations) == 0 {
+		return nil
+	}
+	return t.Variations[0]
+}
+
+// === Parser ===
+
+// Reads all the game trees in an SGF file.
+func Parse(input io.Reader) ([]*GameTree, error) {
+	p := &parser{in: bufio.NewReader(input)}
+	var trees []*GameTree
+	for {
+		c, err := p.skipSpace()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if c != '(' {
+			return nil, p.errorf("expected '(' but got %q", c)
+		}
+		tree, err := p.parseGameTree()
+		if err != nil {
+			return nil, err
+		}
+		trees = append(trees, tree)
+	}
+	if len(trees) == 0 {
+		return nil, fmt.Errorf("sgf: no game found")
+	}
+	return trees, nil
+}
+
+// Reads an SGF file containing a single game.
+func ParseString(input string) (*GameTree, error) {
+	trees, err := Parse(strings.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	return trees[0], nil
+}
+
+type parser struct {
+	in   *bufio.Reader
+	line int  // for error messages; counts from 0
+	last byte // the last byte read, for unread
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("sgf: line %v: %v", p.line+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) read() (byte, error) {
+	c, err := p.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if c == '\n' {
+		p.line++
+	}
+	p.last = c
+	return c, nil
+}
+
+// Puts back the last byte read, so it's read (and counted) again.
+func (p *parser) unread() {
+	p.in.UnreadByte()
+	if p.last == '\n' {
+		p.line--
+	}
+}
+
+// Returns the next character that isn't whitespace.
+func (p *parser) skipSpace() (byte, error) {
+	for {
+		c, err := p.read()
+		if err != nil {
+			return 0, err
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			return c, nil
+		}
+	}
+}
+
+// Parses the rest of a game tree, after its opening parenthesis.
+func (p *parser) parseGameTree() (*GameTree, error) {
+	tree := new(GameTree)
+	for {
+		c, err := p.skipSpace()
+		if err != nil {
+			return nil, p.errorf("unexpected end of game tree")
+		}
+		switch {
+		case c == ';' && len(tree.Variations) == 0:
+			node, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			tree.Nodes = append(tree.Nodes, node)
+		case c == '(' && len(tree.Nodes) > 0:
+			variation, err := p.parseGameTree()
+			if err != nil {
+				return nil, err
+			}
+			tree.Variations = append(tree.Variations, variation)
+		case c == ')' && len(tree.Nodes) > 0:
+			return tree, nil
+		default:
+			return nil, p.errorf("unexpected character in game tree: %q", c)
+		}
+	}
+}
+
+// Parses the properties of a node, after its semicolon.
+func (p *parser) parseNode() (*Node, error) {
+	node := new(Node)
+	for {
+		c, err := p.skipSpace()
+		if err != nil {
+			return nil, p.errorf("unexpected end of node")
+		}
+		if !isLetter(c) {
+			p.unread()
+			return node, nil
+		}
+
+		// Read the property's name. (FF[3] allowed lowercase letters, which are ignored.)
+		var id bytes.Buffer
+		for isLetter(c) {
+			if c >= 'A' && c <= 'Z' {
+				id.WriteByte(c)
+			}
+			if c, err = p.read(); err != nil {
+				return nil, p.errorf("unexpected end of property")
+			}
+		}
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			if c, err = p.skipSpace(); err != nil {
+				return nil, p.errorf("unexpected end of property")
+			}
+		}
+		if c != '[' {
+			return nil, p.errorf("expected '[' after %v but got %q", id.String(), c)
+		}
+
+		// read one or more values
+		var values []string
+		for c == '[' {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			if c, err = p.skipSpace(); err != nil {
+				return nil, p.errorf("unexpected end of node")
+			}
+		}
+		p.unread()
+		node.Add(id.String(), values...)
+	}
+}
+
+// Parses a property value, after its opening bracket.
+func (p *parser) parseValue() (string, error) {
+	var value bytes.Buffer
+	for {
+		c, err := p.read()
+		if err != nil {
+			return "", p.errorf("unexpected end of property value")
+		}
+		switch c {
+		case ']':
+			return value.String(), nil
+		case '\\':
+			if c, err = p.read(); err != nil {
+				return "", p.errorf("unexpected end of property value")
+			}
+			if c == '\n' || c == '\r' {
+				// a soft line break; "\r\n" and "\n\r" are skipped as a whole
+				if next, err := p.read(); err == nil && (next == c || next != '\n' && next != '\r') {
+					p.unread()
+				}
+				continue
+			}
+		}
+		value.WriteByte(c)
+	}
+}
+
+func isLetter(c byte) bool { return (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') }
+
+// === Writer ===
+
+// Writes a game tree in SGF format.
+func (t *GameTree) Write(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	t.write(w)
+	return w.Flush()
+}
+
+func (t *GameTree) String() string {
+	var out bytes.Buffer
+	t.Write(&out)
+	return out.String()
+}
+
+// The maximum number of nodes on each line of output,
+// to keep lines reasonably short.
+const nodesPerLine = 10
+
+func (t *GameTree) write(w *bufio.Writer) {
+	w.WriteString("(")
+	for i, node := range t.Nodes {
+		if i > 0 && i%nodesPerLine == 1 {
+			w.WriteString("\n")
+		}
+		w.WriteString(";")
+		for _, p := range node.Properties {
+			w.WriteString(p.ID)
+			for _, value := range p.Values {
+				w.WriteString("[")
+				w.WriteString(escape(value))
+				w.WriteString("]")
+			}
+		}
+	}
+	for _, variation := range t.Variations {
+		w.WriteString("\n")
+		variation.write(w)
+	}
+	w.WriteString(")")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `]`, `\]`)
+
+func escape(value string) string { return escaper.Replace(value) }
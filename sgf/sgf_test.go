@@ -0,0 +1,129 @@
+package sgf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNodesAndProperties(t *testing.T) {
+	tree, err := ParseString("(;FF[4]SZ[9]\n AB[aa][bb] ;B[cc];W[])")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Nodes) != 3 {
+		t.Fatalf("expected 3 nodes but got %v", len(tree.Nodes))
+	}
+	root := tree.Nodes[0]
+	if value, ok := root.Get("SZ"); !ok || value != "9" {
+		t.Errorf("wrong SZ: %q, %v", value, ok)
+	}
+	if values := root.GetAll("AB"); len(values) != 2 || values[0] != "aa" || values[1] != "bb" {
+		t.Errorf("wrong AB: %v", values)
+	}
+	if _, ok := root.Get("KM"); ok {
+		t.Error("didn't expect KM")
+	}
+	if value, ok := tree.Nodes[2].Get("W"); !ok || value != "" {
+		t.Errorf("wrong pass: %q, %v", value, ok)
+	}
+}
+
+func TestParseEscapes(t *testing.T) {
+	tree, err := ParseString(`(;C[a \] b \\ c\` + "\n" + `d])`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := tree.Nodes[0].Get("C"); value != `a ] b \ cd` {
+		t.Errorf("wrong comment: %q", value)
+	}
+
+	// soft line breaks with two-byte line endings
+	for _, lineEnd := range []string{"\r\n", "\n\r", "\r"} {
+		tree, err := ParseString("(;C[a\\" + lineEnd + "b])")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value, _ := tree.Nodes[0].Get("C"); value != "ab" {
+			t.Errorf("wrong comment for line end %q: %q", lineEnd, value)
+		}
+	}
+}
+
+func TestParseErrorLineNumber(t *testing.T) {
+	_, err := ParseString("(;C[a\\\r\nb]\n;B)")
+	if err == nil || !strings.Contains(err.Error(), "line 3:") {
+		t.Errorf("expected an error on line 3 but got %v", err)
+	}
+}
+
+func TestParseVariations(t *testing.T) {
+	tree, err := ParseString("(;SZ[9];B[aa](;W[bb];B[cc])(;W[dd]))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Variations) != 2 {
+		t.Fatalf("expected 2 variations but got %v", len(tree.Variations))
+	}
+	main := tree.MainLine()
+	if len(main) != 4 {
+		t.Fatalf("expected 4 nodes in main line but got %v", len(main))
+	}
+	if value, _ := main[3].Get("B"); value != "cc" {
+		t.Errorf("wrong last move: %q", value)
+	}
+}
+
+func TestParseMultipleGames(t *testing.T) {
+	trees, err := Parse(strings.NewReader("(;SZ[9]) (;SZ[13])"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trees) != 2 {
+		t.Errorf("expected 2 games but got %v", len(trees))
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"()",
+		"(;B[aa]",
+		"(;B[aa)",
+		"(;B)",
+		"x(;B[aa])",
+		"(;SZ[9](;B[aa]);W[bb])",
+	} {
+		if _, err := ParseString(input); err == nil {
+			t.Errorf("expected an error for %q", input)
+		}
+	}
+}
+
+func TestWriteGameTree(t *testing.T) {
+	input := "(;FF[4]C[a \\] b]\n;B[aa];W[bb]\n(;B[cc])\n(;B[dd]))"
+	tree, err := ParseString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output := tree.String(); output != input {
+		t.Errorf("expected:\n%v\nbut got:\n%v", input, output)
+	}
+}
+
+func TestWriteBreaksLongLines(t *testing.T) {
+	tree := &GameTree{}
+	for i := 0; i < 22; i++ {
+		node := new(Node)
+		node.Add("B", "aa")
+		tree.Nodes = append(tree.Nodes, node)
+	}
+	lines := strings.Split(tree.String(), "\n")
+	if len(lines) != 4 {
+		t.Errorf("expected 4 lines but got %v", len(lines))
+	}
+	for _, line := range lines {
+		if line == "" {
+			t.Error("unexpected blank line")
+		}
+	}
+}
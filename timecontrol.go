@@ -0,0 +1,126 @@
+package gongo
+
+import (
+	"time"
+)
+
+// === Time management ===
+
+// When the controller tells the robot about the time limits (using GTP's
+// time_settings or time_left commands), the robot decides how long to think
+// about each move based on the time remaining on its clock, instead of using
+// Config.MoveTime.
+
+const (
+	// Time held back from each budget to allow for network lag
+	// and the overhead of choosing a move after the search.
+	timeSafetyMargin = 500 * time.Millisecond
+
+	// The minimum number of moves that we assume are left in the game
+	// when dividing up the main time.
+	minMovesLeft = 10
+
+	// The shortest time we'll think, even when nearly out of time.
+	minMoveTime = 10 * time.Millisecond
+)
+
+// The time left for one player.
+type clock struct {
+	timeLeft time.Duration // time left in main time or the current byo-yomi period
+	stones   int           // stones left to play (Canadian) or periods left (Japanese); 0 in main time
+}
+
+// Resets a clock to the start of a game.
+func (c *clock) reset(settings TimeSettings) {
+	c.timeLeft = settings.MainTime
+	c.stones = 0
+	if c.timeLeft == 0 {
+		c.startByoYomi(settings)
+	}
+}
+
+// Moves the clock into byo-yomi when main time runs out.
+func (c *clock) startByoYomi(settings TimeSettings) {
+	switch settings.System {
+	case CanadianByoYomi:
+		c.timeLeft = settings.ByoYomiTime
+		c.stones = settings.ByoYomiStones
+	case JapaneseByoYomi:
+		c.timeLeft = settings.ByoYomiTime
+		c.stones = settings.ByoYomiPeriods
+	}
+}
+
+// Updates the clock after a move that took the given amount of time.
+// (This keeps the clock roughly right if the controller doesn't send
+// time_left after each move.)
+func (c *clock) spend(elapsed time.Duration, settings TimeSettings) {
+	c.timeLeft -= elapsed
+	switch {
+	case c.stones == 0:
+		if c.timeLeft <= 0 {
+			c.startByoYomi(settings)
+		}
+	case settings.System == CanadianByoYomi:
+		c.stones--
+		if c.stones == 0 {
+			c.startByoYomi(settings) // start a new period
+		}
+	case settings.System == JapaneseByoYomi:
+		if c.timeLeft <= 0 && c.stones > 1 {
+			c.stones-- // used up a period
+		}
+		c.timeLeft = settings.ByoYomiTime
+	}
+	if c.timeLeft < 0 {
+		c.timeLeft = 0
+	}
+}
+
+// Returns how long to think about the next move, given the number of empty
+// points left on the board. Returns zero if there's no time limit.
+func (c *clock) moveBudget(settings TimeSettings, emptyPoints int) time.Duration {
+	var budget time.Duration
+	switch {
+	case settings.System == NoTimeLimit:
+		return 0
+	case c.stones == 0:
+		// In main time; assume we'll play about half the empty points.
+		movesLeft := emptyPoints / 2
+		if movesLeft < minMovesLeft {
+			movesLeft = minMovesLeft
+		}
+		budget = (c.timeLeft - timeSafetyMargin) / time.Duration(movesLeft)
+	case settings.System == CanadianByoYomi:
+		budget = (c.timeLeft - timeSafetyMargin) / time.Duration(c.stones)
+	default:
+		// Japanese byo-yomi: each move can use a whole period.
+		budget = c.timeLeft - timeSafetyMargin
+	}
+	if budget < minMoveTime {
+		return minMoveTime
+	}
+	return budget
+}
+
+func (r *robot) SetTimeSettings(settings TimeSettings) {
+	r.timeSettings = settings
+	r.clocks[Black].reset(settings)
+	r.clocks[White].reset(settings)
+}
+
+func (r *robot) SetTimeLeft(color Color, timeLeft time.Duration, stones int) {
+	r.clocks[color] = clock{timeLeft: timeLeft, stones: stones}
+}
+
+// Returns how long to think about the next move for the given color,
+// or zero if there's no time limit.
+func (r *robot) timeBudget(color Color) time.Duration {
+	emptyPoints := 0
+	for _, pt := range r.board.allPoints {
+		if r.board.cells[pt] == EMPTY {
+			emptyPoints++
+		}
+	}
+	return r.clocks[color].moveBudget(r.timeSettings, emptyPoints)
+}
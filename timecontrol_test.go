@@ -0,0 +1,87 @@
+package gongo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoveBudgetInMainTime(t *testing.T) {
+	settings := TimeSettings{System: AbsoluteTime, MainTime: 60 * time.Second}
+	var c clock
+	c.reset(settings)
+	// 80 empty points; assume 40 moves left
+	checkBudget(t, (60*time.Second-timeSafetyMargin)/40, c.moveBudget(settings, 80))
+	// near the end of the game, assume some moves are left anyway
+	checkBudget(t, (60*time.Second-timeSafetyMargin)/minMovesLeft, c.moveBudget(settings, 3))
+}
+
+func TestMoveBudgetWhenOutOfTime(t *testing.T) {
+	settings := TimeSettings{System: AbsoluteTime, MainTime: 60 * time.Second}
+	c := clock{timeLeft: 100 * time.Millisecond}
+	checkBudget(t, minMoveTime, c.moveBudget(settings, 80))
+}
+
+func TestMoveBudgetWithNoTimeLimit(t *testing.T) {
+	var c clock
+	checkBudget(t, 0, c.moveBudget(TimeSettings{System: NoTimeLimit}, 80))
+}
+
+func TestMoveBudgetInByoYomi(t *testing.T) {
+	canadian := TimeSettings{System: CanadianByoYomi, ByoYomiTime: 300 * time.Second, ByoYomiStones: 25}
+	c := clock{timeLeft: 100 * time.Second, stones: 10}
+	checkBudget(t, (100*time.Second-timeSafetyMargin)/10, c.moveBudget(canadian, 80))
+
+	japanese := TimeSettings{System: JapaneseByoYomi, ByoYomiTime: 30 * time.Second, ByoYomiPeriods: 5}
+	c = clock{timeLeft: 30 * time.Second, stones: 3}
+	checkBudget(t, 30*time.Second-timeSafetyMargin, c.moveBudget(japanese, 80))
+}
+
+func TestClockEntersByoYomi(t *testing.T) {
+	settings := TimeSettings{System: CanadianByoYomi, MainTime: 10 * time.Second,
+		ByoYomiTime: 60 * time.Second, ByoYomiStones: 2}
+	var c clock
+	c.reset(settings)
+	c.spend(11*time.Second, settings)
+	checkClock(t, clock{timeLeft: 60 * time.Second, stones: 2}, c)
+	c.spend(5*time.Second, settings)
+	checkClock(t, clock{timeLeft: 55 * time.Second, stones: 1}, c)
+	c.spend(5*time.Second, settings)
+	checkClock(t, clock{timeLeft: 60 * time.Second, stones: 2}, c)
+}
+
+func TestClockUsesJapanesePeriods(t *testing.T) {
+	settings := TimeSettings{System: JapaneseByoYomi, ByoYomiTime: 30 * time.Second, ByoYomiPeriods: 3}
+	var c clock
+	c.reset(settings)
+	checkClock(t, clock{timeLeft: 30 * time.Second, stones: 3}, c)
+	c.spend(10*time.Second, settings)
+	checkClock(t, clock{timeLeft: 30 * time.Second, stones: 3}, c)
+	c.spend(40*time.Second, settings)
+	checkClock(t, clock{timeLeft: 30 * time.Second, stones: 2}, c)
+}
+
+func TestGenMoveUsesClock(t *testing.T) {
+	r := NewRobot(9).(*robot)
+	r.SetTimeSettings(TimeSettings{System: AbsoluteTime, MainTime: 5 * time.Second})
+	r.SetTimeLeft(Black, 2*time.Second, 0)
+	limit := r.searchLimit(Black, time.Now())
+	if limit.deadline.IsZero() || limit.maxPlayouts != 0 {
+		t.Errorf("expected a deadline and no playout limit; got %v", limit)
+	}
+	checkGenAnyMove(t, r, Black)
+	if r.clocks[Black].timeLeft >= 2*time.Second {
+		t.Errorf("clock didn't run: %v", r.clocks[Black].timeLeft)
+	}
+}
+
+func checkBudget(t *testing.T, expected, actual time.Duration) {
+	if expected != actual {
+		t.Errorf("expected budget of %v but got %v", expected, actual)
+	}
+}
+
+func checkClock(t *testing.T, expected, actual clock) {
+	if expected != actual {
+		t.Errorf("expected clock %+v but got %+v", expected, actual)
+	}
+}
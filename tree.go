@@ -0,0 +1,599 @@
+package gongo
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// === Monte-Carlo tree search ===
+
+// The robot chooses moves using UCT (UCB1 applied to trees). Each playout
+// starts at the root, which represents the current position, and descends
+// the tree by choosing the child with the best upper confidence bound on its
+// win rate. When it reaches a node that has been visited before, the node is
+// expanded. From there, the rest of the game is played randomly and the
+// result is recorded in each node along the path.
+//
+// Each node also keeps RAVE (Rapid Action Value Estimation) statistics, which
+// are the All-Moves-As-First statistics from the Java reference bot applied
+// at every level of the tree: a playout counts for a child if the child's
+// move was played by the same player at any time after the parent's position,
+// not just as the next move. These statistics are noisier but accumulate
+// much faster, so they're blended with the child's own win rate, with less
+// weight as the child gets more visits.
+
+// A node represents the position reached by playing a sequence of moves
+// from the root.
+type node struct {
+	move     pt   // the move that leads to this node from its parent (PASS for the root)
+	color    cell // the color of the player who made the move
+	children []*node
+	expanded bool // true after children has been filled in
+
+	visits int     // the number of playouts that went through this node
+	wins   float64 // the number of those playouts that color won (draws count half)
+
+	// The number of playouts where color played this node's move first after
+	// the parent's position (in any order), and how many of them color won.
+	raveVisits int
+	raveWins   float64
+}
+
+// Creates a root node for the current position on the given board,
+// with a child for each move that the given function accepts.
+func newRoot(b *board, rand Randomness, accept func(move pt) bool) *node {
+	root := &node{move: PASS, color: b.getFriendlyStone() ^ 3}
+	root.expandWith(b, rand, accept)
+	return root
+}
+
+// Adds a child for every empty point on the board where the player to move
+// could play without filling in an eye. (Some of these moves may turn out to
+// be illegal; they're removed when the search tries to play them.)
+func (n *node) expand(b *board, rand Randomness) {
+	n.children = newChildren(b, rand, func(move pt) bool { return b.cells[move] == EMPTY })
+	n.expanded = true
+}
+
+func (n *node) expandWith(b *board, rand Randomness, accept func(move pt) bool) {
+	n.children = newChildren(b, rand, accept)
+	n.expanded = true
+}
+
+// Returns a node for each move by the player to move that the given function
+// accepts and that doesn't fill in an eye, in random order.
+func newChildren(b *board, rand Randomness, accept func(move pt) bool) []*node {
+	color := b.getFriendlyStone()
+	children := make([]*node, 0, len(b.allPoints))
+	for _, pt := range b.allPoints {
+		if !b.wouldFillEye(pt) && accept(pt) {
+			children = append(children, &node{move: pt, color: color})
+		}
+	}
+
+	// shuffle the children so that ties are broken randomly
+	for i := range children {
+		randomIndex := i + rand.Intn(len(children)-i)
+		children[i], children[randomIndex] = children[randomIndex], children[i]
+	}
+	return children
+}
+
+// Removes a child whose move turned out to be illegal.
+func (n *node) removeChild(child *node) {
+	for i, c := range n.children {
+		if c == child {
+			last := len(n.children) - 1
+			n.children[i] = n.children[last]
+			n.children[last] = nil
+			n.children = n.children[:last]
+			return
+		}
+	}
+}
+
+// Chooses the child to explore next, using UCB1 on the child's blended win
+// rate. (See blendedWinRate for how raveEquivalence is used.) Children that
+// haven't been visited and have no RAVE statistics are tried first.
+// Returns nil if there are no children.
+func (n *node) selectChild(exploration, raveEquivalence float64) *node {
+	logVisits := math.Log(float64(n.visits))
+	var best *node
+	bestValue := math.Inf(-1)
+	for _, child := range n.children {
+		var value float64
+		if child.visits > 0 {
+			value = child.blendedWinRate(raveEquivalence) +
+				exploration*math.Sqrt(logVisits/float64(child.visits))
+		} else if raveEquivalence > 0 && child.raveVisits > 0 {
+			// no playouts of our own; estimate as if the RAVE statistics were one visit
+			value = child.raveWinRate() + exploration*math.Sqrt(logVisits)
+		} else {
+			return child
+		}
+		if value > bestValue {
+			best = child
+			bestValue = value
+		}
+	}
+	return best
+}
+
+// Returns a weighted average of the node's win rate and its RAVE win rate.
+// The weight given to RAVE is beta = sqrt(k / (3n + k)), where n is the
+// number of visits and k is the equivalence parameter: the number of visits
+// at which both win rates count equally. If k is zero, RAVE isn't used.
+func (n *node) blendedWinRate(raveEquivalence float64) float64 {
+	if raveEquivalence <= 0 || n.raveVisits == 0 {
+		return n.winRate()
+	}
+	beta := math.Sqrt(raveEquivalence / (3*float64(n.visits) + raveEquivalence))
+	return (1-beta)*n.winRate() + beta*n.raveWinRate()
+}
+
+// Returns the child with the most visits, or nil if there are no children.
+// (The most-visited child is more reliable than the one with the highest
+// win rate, which may have only a few samples.)
+func (n *node) bestChild() *node {
+	var best *node
+	for _, child := range n.children {
+		if best == nil || child.visits > best.visits {
+			best = child
+		}
+	}
+	return best
+}
+
+// Returns the fraction of playouts through this node that were won by the
+// player who made its move.
+func (n *node) winRate() float64 {
+	if n.visits == 0 {
+		return 0
+	}
+	return n.wins / float64(n.visits)
+}
+
+// Returns the fraction of playouts counted for this node's RAVE statistics
+// that were won by the player who made its move.
+func (n *node) raveWinRate() float64 {
+	if n.raveVisits == 0 {
+		return 0
+	}
+	return n.raveWins / float64(n.raveVisits)
+}
+
+// Adds the result of a playout to the RAVE statistics of each child whose move
+// was first played by the child's color. The amaf array holds, for each point,
+// the color of the first player to play there after this node's position.
+func (n *node) updateRave(amaf []cell, blackWins float64) {
+	for _, child := range n.children {
+		if amaf[child.move] == child.color {
+			child.raveVisits++
+			if child.color == BLACK {
+				child.raveWins += blackWins
+			} else {
+				child.raveWins += 1 - blackWins
+			}
+		}
+	}
+}
+
+// A searcher holds the state for one goroutine running playouts. Each
+// searcher has its own board and source of randomness; the search tree
+// is shared and protected by r.treeLock.
+type searcher struct {
+	board      *board
+	randomness Randomness
+	path       []*node // nodes visited during a playout
+	amaf       []cell  // the first color to play at each point in a playout
+
+	// The number of playouts this searcher has run in the current search,
+	// and how many of them ended with each point owned by each player.
+	playouts               int
+	blackOwned, whiteOwned []int
+}
+
+func newSearcher(size int, randomness Randomness, policy playoutPolicy) *searcher {
+	s := &searcher{board: new(board), randomness: randomness}
+	s.board.clearBoard(size)
+	s.board.policy = policy
+	s.amaf = make([]cell, len(s.board.cells))
+	s.blackOwned = make([]int, len(s.board.cells))
+	s.whiteOwned = make([]int, len(s.board.cells))
+	return s
+}
+
+// Counts who owns each point at the end of a playout, the same way as
+// getEasyScore. All the stones left on the board are alive.
+func (s *searcher) recordOwners(sb *board) (count pointCount) {
+	s.playouts++
+	for _, pt := range sb.allPoints {
+		switch sb.getEasyOwner(pt) {
+		case BLACK:
+			s.blackOwned[pt]++
+			count.area++
+		case WHITE:
+			s.whiteOwned[pt]++
+			count.area--
+		}
+		switch sb.cells[pt] {
+		case BLACK:
+			count.liveStones++
+		case WHITE:
+			count.liveStones--
+		}
+	}
+	return count
+}
+
+// Clears statistics from the previous search.
+func (s *searcher) reset() {
+	s.playouts = 0
+	for i := range s.blackOwned {
+		s.blackOwned[i] = 0
+		s.whiteOwned[i] = 0
+	}
+}
+
+// Limits on how long a search may run.
+type searchLimit struct {
+	maxPlayouts int             // zero means no limit
+	deadline    time.Time       // zero means no deadline
+	stop        <-chan struct{} // stops the search when closed; nil means never
+	allPlayouts bool            // keeps going after the best move is decided
+}
+
+// Returns true if a search that started the given number of playouts since
+// startTime should stop, either because it ran out of playouts or time, or
+// because the root's best child can no longer be overtaken (unless
+// allPlayouts is set), or because it was stopped.
+func (l searchLimit) reached(root *node, playouts int, startTime time.Time) bool {
+	select {
+	case <-l.stop:
+		return true
+	default:
+	}
+	remaining := math.MaxInt
+	if l.maxPlayouts > 0 {
+		remaining = l.maxPlayouts - playouts
+		if remaining <= 0 {
+			return true
+		}
+	}
+	if !l.deadline.IsZero() {
+		now := time.Now()
+		if !now.Before(l.deadline) {
+			return true
+		}
+		if elapsed := now.Sub(startTime); elapsed > 0 && playouts > 0 {
+			// estimate how many more playouts we have time for
+			rate := float64(playouts) / float64(elapsed)
+			if estimate := int(rate * float64(l.deadline.Sub(now))); estimate < remaining {
+				remaining = estimate
+			}
+		}
+	}
+	return !l.allPlayouts && root.decided(remaining)
+}
+
+// Returns true if the child with the most visits would still have the most
+// visits after the given number of additional playouts, no matter which
+// children they go to.
+func (n *node) decided(remainingPlayouts int) bool {
+	if len(n.children) == 0 {
+		return false
+	}
+	first, second := 0, 0
+	for _, child := range n.children {
+		if child.visits > first {
+			first, second = child.visits, first
+		} else if child.visits > second {
+			second = child.visits
+		}
+	}
+	return first-second > remainingPlayouts
+}
+
+// Makes r.root a search tree for the current position, keeping the results
+// of any earlier search of this position. The root's children are limited
+// to moves that are legal in the actual game, including superko, and that
+// don't run out a chain that's caught in a ladder or put a chain in atari.
+func (r *robot) prepareRoot() {
+	// Each move is tried on the scratch board and taken back, so the board
+	// only needs to be copied once. (The ladder and self-atari checks also
+	// leave the board unchanged.)
+	sb := r.scratchBoard
+	sb.copyFrom(r.board)
+	accept := func(move pt) bool {
+		if result, _ := sb.makeMove(move); result != played {
+			return false
+		}
+		repeats := r.repeatsPosition(sb)
+		sb.undo()
+		return !repeats && !sb.runsIntoLadder(move) && !sb.isSelfAtari(move)
+	}
+	switch {
+	case r.root == nil:
+		r.root = newRoot(r.board, r.randomness, accept)
+	case !r.root.expanded:
+		r.root.expandWith(r.board, r.randomness, accept)
+	default:
+		// The children were added during a search, which doesn't check for superko.
+		for i := 0; i < len(r.root.children); {
+			if child := r.root.children[i]; !accept(child.move) {
+				r.root.removeChild(child)
+			} else {
+				i++
+			}
+		}
+	}
+}
+
+// Moves the root of the search tree down to the position after a move that
+// was just played, so that the search results for that position are kept.
+// If that move wasn't searched, there's no tree.
+func (r *robot) advanceRoot(move pt, color cell) {
+	if r.root == nil {
+		return
+	}
+	// The ownership estimate refers to the old root; drop it so that the
+	// rest of the old tree can be garbage collected.
+	if r.ownership != nil && r.ownership.root == r.root {
+		r.ownership = nil
+	}
+	var next *node
+	for _, child := range r.root.children {
+		if child.move == move && child.color == color {
+			next = child
+			break
+		}
+	}
+	r.root = next
+}
+
+// Runs playouts from the current position until the limit is reached, adding
+// the results to the tree at r.root. The playouts are divided between the
+// robot's searchers, each running in its own goroutine. Returns the number of
+// playouts run.
+func (r *robot) search(limit searchLimit) (playouts int) {
+	startTime := time.Now()
+	for _, s := range r.searchers {
+		s.reset()
+	}
+
+	if len(r.searchers) == 1 {
+		for !limit.reached(r.root, playouts, startTime) {
+			r.playout(r.searchers[0])
+			playouts++
+		}
+		return playouts
+	}
+
+	// The searchers reserve playouts with an atomic counter, so that they
+	// only take r.treeLock to walk and update the tree. The rest of the limit
+	// looks at the tree, so it's checked every few playouts instead of each
+	// time.
+	var reserved, finished int64
+	var stopped int32
+	var done sync.WaitGroup
+	for _, s := range r.searchers {
+		done.Add(1)
+		go func(s *searcher) {
+			defer done.Done()
+			for atomic.LoadInt32(&stopped) == 0 {
+				started := int(atomic.AddInt64(&reserved, 1)) - 1
+				if limit.maxPlayouts > 0 && started >= limit.maxPlayouts {
+					return
+				}
+				if started%limitCheckInterval == 0 {
+					r.treeLock.Lock()
+					reached := limit.reached(r.root, started, startTime)
+					r.treeLock.Unlock()
+					if reached {
+						atomic.StoreInt32(&stopped, 1)
+						return
+					}
+				}
+				r.playout(s)
+				atomic.AddInt64(&finished, 1)
+			}
+		}(s)
+	}
+	done.Wait()
+	return int(finished)
+}
+
+// How often a search with more than one searcher checks whether it should
+// stop, in playouts.
+const limitCheckInterval = 8
+
+// Plays one game from the root: first by descending the tree, then randomly.
+func (r *robot) playout(s *searcher) {
+	sb := s.board
+	sb.copyFrom(r.board)
+
+	// Visits are counted on the way down, so that other goroutines see this
+	// playout as a loss until its result is known (a "virtual loss") and
+	// are less likely to choose the same path. The lock is only held to
+	// choose each child; moves are played and nodes expanded without it.
+	r.treeLock.Lock()
+	n := r.root
+	n.visits++
+	path := append(s.path[:0], n)
+	for n.expanded || n.visits > 1 {
+		if !n.expanded {
+			r.treeLock.Unlock()
+			children := newChildren(sb, s.randomness, func(move pt) bool { return sb.cells[move] == EMPTY })
+			r.treeLock.Lock()
+			if !n.expanded { // another goroutine may have gotten here first
+				n.children = children
+				n.expanded = true
+			}
+		}
+		child := n.selectChild(r.exploration, r.raveEquivalence)
+		if child == nil {
+			break // no moves left; the random game will pass
+		}
+		child.visits++
+		r.treeLock.Unlock()
+		result, _ := sb.makeMove(child.move)
+		r.treeLock.Lock()
+		if !result.ok() {
+			child.visits--
+			n.removeChild(child)
+			continue
+		}
+		n = child
+		path = append(path, n)
+	}
+	s.path = path
+	r.treeLock.Unlock()
+
+	sb.playRandomGame(s.randomness)
+	score := r.score(sb, s.recordOwners(sb))
+
+	// find the result from Black's point of view
+	var blackWins float64
+	if score > 0 {
+		blackWins = 1
+	} else if score < 0 {
+		blackWins = 0
+	} else {
+		blackWins = 0.5 // a draw
+	}
+
+	r.treeLock.Lock()
+	for _, n := range path {
+		if n.color == BLACK {
+			n.wins += blackWins
+		} else {
+			n.wins += 1 - blackWins
+		}
+	}
+	r.treeLock.Unlock()
+
+	if r.raveEquivalence > 0 {
+		r.updateRave(s, blackWins)
+	}
+}
+
+// Updates the RAVE statistics for the children of each node on the
+// searcher's path, after a playout has finished.
+func (r *robot) updateRave(s *searcher, blackWins float64) {
+	sb, path, amaf := s.board, s.path, s.amaf
+	start := r.board.moveCount
+
+	// Walk backwards through the playout so that amaf[pt] ends up with the color
+	// of the first player to play at pt. The node at depth d on the path is the
+	// position before move start+d, so its children are updated as soon as
+	// that move has been seen. The moves after the path don't update any
+	// nodes, so they're walked before taking the lock.
+	i := sb.moveCount - 1
+	for ; i >= start+len(path); i-- {
+		recordFirstPlay(amaf, sb.moves[i])
+	}
+	r.treeLock.Lock()
+	for ; i >= start; i-- {
+		recordFirstPlay(amaf, sb.moves[i])
+		path[i-start].updateRave(amaf, blackWins)
+	}
+	r.treeLock.Unlock()
+
+	// clear amaf for the next playout
+	for i := start; i < sb.moveCount; i++ {
+		amaf[sb.moves[i]&MOVE_TO_PT_MASK] = EMPTY
+	}
+}
+
+// Sets amaf at the point of a recorded move to the color that played it.
+func recordFirstPlay(amaf []cell, move pt) {
+	color := BLACK
+	if move&WHITE_MOVE != 0 {
+		color = WHITE
+	}
+	if pt := move & MOVE_TO_PT_MASK; pt != PASS {
+		amaf[pt] = color
+	}
+}
+
+// === Searching in the background ===
+
+// A search running in its own goroutine until it's stopped.
+type backgroundSearch struct {
+	stop chan struct{} // closed to stop the search
+	done chan struct{} // closed when the search has stopped
+}
+
+func (r *robot) StartSearch(color Color) {
+	r.StopSearch()
+	r.SetToPlay(color)
+	r.prepareRoot()
+	r.startBackground(searchLimit{})
+}
+
+// The most playouts to run while pondering, so that the tree doesn't use
+// up all the memory if the opponent takes a long time.
+const maxPonderPlayouts = 500000
+
+// Starts searching the current position on the opponent's time, after
+// GenMove. The search stops when the next move is played; if the opponent's
+// move was searched, Play keeps its part of the tree.
+func (r *robot) startPondering() {
+	r.prepareRoot()
+	r.startBackground(searchLimit{maxPlayouts: maxPonderPlayouts})
+}
+
+// Runs a search in another goroutine until StopSearch is called or the limit
+// is reached. (The limit's stop channel is filled in.)
+func (r *robot) startBackground(limit searchLimit) {
+	bg := &backgroundSearch{stop: make(chan struct{}), done: make(chan struct{})}
+	r.background = bg
+	limit.stop = bg.stop
+	go func() {
+		defer close(bg.done)
+		r.search(limit)
+	}()
+}
+
+func (r *robot) StopSearch() {
+	if r.background == nil {
+		return
+	}
+	close(r.background.stop)
+	<-r.background.done
+	r.background = nil
+}
+
+func (r *robot) GetSearchStats() []MoveStats {
+	if r.root == nil {
+		return nil
+	}
+	r.treeLock.Lock()
+	defer r.treeLock.Unlock()
+
+	b := r.board
+	var stats []MoveStats
+	for _, child := range r.root.children {
+		if child.visits == 0 {
+			continue
+		}
+		x, y := b.getCoords(child.move)
+		s := MoveStats{X: x, Y: y, Visits: child.visits, WinRate: child.winRate()}
+		for n := child; n != nil && n.visits > 0; n = n.bestChild() {
+			x, y := b.getCoords(n.move)
+			s.PrincipalVariation = append(s.PrincipalVariation, Vertex{x, y})
+		}
+		stats = append(stats, s)
+	}
+	sort.Sort(byVisits(stats))
+	return stats
+}
+
+type byVisits []MoveStats
+
+func (s byVisits) Len() int           { return len(s) }
+func (s byVisits) Less(i, j int) bool { return s[i].Visits > s[j].Visits }
+func (s byVisits) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,319 @@
+package gongo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSelectChildTriesUnvisitedFirst(t *testing.T) {
+	n := &node{visits: 10}
+	visited := &node{visits: 10, wins: 10}
+	unvisited := &node{}
+	n.children = []*node{visited, unvisited}
+	if n.selectChild(1.0, 0) != unvisited {
+		t.Error("didn't choose unvisited child")
+	}
+}
+
+func TestSelectChildUsesUpperConfidenceBound(t *testing.T) {
+	n := &node{visits: 100}
+	good := &node{visits: 50, wins: 40}
+	bad := &node{visits: 50, wins: 10}
+	n.children = []*node{bad, good}
+	if n.selectChild(1.0, 0) != good {
+		t.Error("didn't choose child with higher win rate")
+	}
+
+	// a child with few visits gets explored even if its win rate is lower
+	n = &node{visits: 1000}
+	wellKnown := &node{visits: 990, wins: 600}
+	rarelyTried := &node{visits: 10, wins: 5}
+	n.children = []*node{wellKnown, rarelyTried}
+	if n.selectChild(1.0, 0) != rarelyTried {
+		t.Error("didn't explore rarely tried child")
+	}
+	if n.selectChild(0.0, 0) != wellKnown {
+		t.Error("didn't exploit when exploration is zero")
+	}
+}
+
+func TestBestChildHasMostVisits(t *testing.T) {
+	n := &node{}
+	if n.bestChild() != nil {
+		t.Error("expected no best child when there are no children")
+	}
+	mostVisited := &node{visits: 20, wins: 11}
+	n.children = []*node{{visits: 3, wins: 3}, mostVisited, {visits: 10, wins: 2}}
+	if n.bestChild() != mostVisited {
+		t.Error("didn't choose most visited child")
+	}
+}
+
+func TestDecided(t *testing.T) {
+	n := &node{}
+	if n.decided(0) {
+		t.Error("a node without children shouldn't be decided")
+	}
+	n.children = []*node{{visits: 30}, {visits: 50}, {visits: 20}}
+	if !n.decided(19) {
+		t.Error("expected decided when the second child can't catch up")
+	}
+	if n.decided(20) {
+		t.Error("expected undecided when the second child could tie")
+	}
+}
+
+func TestSearchLimitReached(t *testing.T) {
+	root := &node{children: []*node{{visits: 1}, {visits: 1}}}
+	start := time.Now()
+
+	limit := searchLimit{maxPlayouts: 10}
+	if limit.reached(root, 9, start) {
+		t.Error("stopped before running out of playouts")
+	}
+	if !limit.reached(root, 10, start) {
+		t.Error("didn't stop after running out of playouts")
+	}
+
+	limit = searchLimit{deadline: start.Add(-time.Second)}
+	if !limit.reached(root, 0, start) {
+		t.Error("didn't stop after the deadline")
+	}
+	limit = searchLimit{deadline: start.Add(time.Hour)}
+	if limit.reached(root, 2, start) {
+		t.Error("stopped before the deadline")
+	}
+
+	root.children[0].visits = 100
+	limit = searchLimit{maxPlayouts: 150}
+	if !limit.reached(root, 101, start) {
+		t.Error("didn't stop when the best move can't be overtaken")
+	}
+
+	stop := make(chan struct{})
+	limit = searchLimit{stop: stop}
+	if limit.reached(root, 1000, start) {
+		t.Error("stopped before the stop channel was closed")
+	}
+	close(stop)
+	if !limit.reached(root, 1000, start) {
+		t.Error("didn't stop after the stop channel was closed")
+	}
+}
+
+func TestBackgroundSearch(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, Threads: 2}).(*robot)
+	r.StopSearch() // does nothing when no search is running
+	r.StartSearch(White)
+	time.Sleep(50 * time.Millisecond)
+	stats := r.GetSearchStats()
+	r.StopSearch()
+
+	if len(stats) == 0 {
+		t.Fatal("expected some statistics")
+	}
+	for i, s := range stats {
+		if i > 0 && s.Visits > stats[i-1].Visits {
+			t.Errorf("stats aren't sorted by visits: %v", stats)
+		}
+		if len(s.PrincipalVariation) == 0 || s.PrincipalVariation[0] != (Vertex{s.X, s.Y}) {
+			t.Errorf("variation doesn't start with the move: %v", s)
+		}
+	}
+	if r.GetToPlay() != White {
+		t.Error("expected White to play")
+	}
+
+	// the robot can be used normally afterwards
+	checkGenAnyMove(t, r, White)
+}
+
+func TestPonderingCarriesOverToNextMove(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100, Ponder: true}).(*robot)
+	checkGenAnyMove(t, r, Black)
+	time.Sleep(50 * time.Millisecond)
+	r.StopSearch()
+
+	reply := r.root.bestChild()
+	if reply == nil || reply.visits == 0 {
+		t.Fatal("expected the opponent's replies to be searched")
+	}
+	x, y := r.board.getCoords(reply.move)
+	if ok, message := r.Play(White, x, y); !ok {
+		t.Fatalf("can't play the searched reply: %v", message)
+	}
+	if r.root != reply {
+		t.Fatal("expected the tree under the opponent's move to be kept")
+	}
+	checkGenAnyMove(t, r, Black)
+
+	// Play stops the search; a move that wasn't searched doesn't keep anything
+	if ok, _ := r.Play(White, 0, 0); !ok || r.root != nil || r.background != nil {
+		t.Error("expected no search or tree after an unsearched move")
+	}
+}
+
+func TestSetKomiDropsTree(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100}).(*robot)
+	checkGenAnyMove(t, r, Black)
+	r.SetKomi(r.GetKomi())
+	if r.root == nil {
+		t.Error("expected the tree to be kept when komi doesn't change")
+	}
+	r.SetKomi(r.GetKomi() + 1)
+	if r.root != nil || r.ownership != nil {
+		t.Error("expected the tree to be dropped when komi changes")
+	}
+}
+
+func TestMutatorsStopPondering(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 100, Ponder: true}).(*robot)
+	mutators := []func(){
+		func() { r.Undo() },
+		func() { r.SetKomi(7.5) },
+		func() { r.SetToPlay(White) },
+		func() { r.SetRules(ChineseRules) },
+		func() { r.ClearBoard() },
+		func() { r.SetStone(Black, 1, 1) },
+		func() { r.SetBoardSize(7) },
+	}
+	for i, mutate := range mutators {
+		checkGenAnyMove(t, r, Black)
+		if r.background == nil {
+			t.Fatal("expected a search in the background")
+		}
+		mutate()
+		if r.background != nil {
+			t.Errorf("mutator %v didn't stop the search", i)
+		}
+		r.ClearBoard()
+	}
+}
+
+func TestGenMoveKeepsTreeForNextMove(t *testing.T) {
+	r := NewConfiguredRobot(Config{BoardSize: 5, SampleCount: 500}).(*robot)
+	checkGenAnyMove(t, r, Black)
+	if r.root == nil || r.root.color != BLACK || r.root.visits == 0 {
+		t.Fatal("expected the tree under the generated move to be kept")
+	}
+	lastMove := r.board.moves[r.board.moveCount-1] & MOVE_TO_PT_MASK
+	if r.root.move != lastMove {
+		t.Errorf("expected root for move %v but got %v", lastMove, r.root.move)
+	}
+
+	reply := r.root.bestChild()
+	x, y := r.board.getCoords(reply.move)
+	if ok, message := r.Play(White, x, y); !ok {
+		t.Fatalf("can't play the searched reply: %v", message)
+	}
+	if r.root != reply {
+		t.Fatal("expected the tree under the opponent's move to be kept")
+	}
+	visits := reply.visits
+	checkGenAnyMove(t, r, Black)
+	if reply.visits <= visits {
+		t.Error("expected the next search to add to the kept tree")
+	}
+}
+
+func TestPrepareRootRemovesIllegalMoves(t *testing.T) {
+	r := NewRobot(3).(*robot)
+	setUpBoard(r, `
+.@.
+@..
+...`)
+	r.SetToPlay(White)
+	legal := &node{move: r.board.makePt(3, 3), color: WHITE}
+	r.root = &node{move: PASS, color: BLACK, expanded: true, children: []*node{
+		{move: r.board.makePt(1, 3), color: WHITE}, // suicide
+		legal,
+	}}
+	r.prepareRoot()
+	if len(r.root.children) != 1 || r.root.children[0] != legal {
+		t.Errorf("expected only the legal move to be kept: %v", r.root.children)
+	}
+}
+
+func TestRemoveChild(t *testing.T) {
+	a, b, c := &node{move: 1}, &node{move: 2}, &node{move: 3}
+	n := &node{children: []*node{a, b, c}}
+	n.removeChild(a)
+	if len(n.children) != 2 || n.children[0] != c || n.children[1] != b {
+		t.Errorf("unexpected children after removal: %v", n.children)
+	}
+}
+
+func TestExpandSkipsOccupiedPointsAndEyes(t *testing.T) {
+	b := makeBoard(`
+.@..
+@.@.
+.@..
+...O`)
+	n := &node{}
+	n.expand(&b, new(fakeRandomness))
+	if !n.expanded {
+		t.Error("node wasn't marked as expanded")
+	}
+	// Black is to move and has eyes at A4 and B3.
+	assertEqualsInt(t, 9, len(n.children), "wrong number of children")
+	for _, child := range n.children {
+		x, y := b.getCoords(child.move)
+		if b.cells[child.move] != EMPTY {
+			t.Errorf("child is on an occupied point: (%v,%v)", x, y)
+		}
+		if b.wouldFillEye(child.move) {
+			t.Errorf("child fills an eye: (%v,%v)", x, y)
+		}
+		if child.color != BLACK {
+			t.Errorf("child has wrong color: %v", child.color)
+		}
+	}
+}
+
+func TestBlendedWinRate(t *testing.T) {
+	n := &node{visits: 10, wins: 10, raveVisits: 100, raveWins: 0}
+	if n.blendedWinRate(0) != 1.0 {
+		t.Error("expected RAVE to be ignored when turned off")
+	}
+	// with k = 30, beta = sqrt(30 / (3*10 + 30)) = sqrt(0.5)
+	expected := 1 - 0.5*1.4142135623730951
+	if actual := n.blendedWinRate(30); actual < expected-1e-9 || actual > expected+1e-9 {
+		t.Errorf("expected %v but got %v", expected, actual)
+	}
+}
+
+func TestSelectChildUsesRave(t *testing.T) {
+	n := &node{visits: 100}
+	likely := &node{raveVisits: 50, raveWins: 40}
+	unlikely := &node{raveVisits: 50, raveWins: 10}
+	n.children = []*node{unlikely, likely}
+	if n.selectChild(0.0, 1000) != likely {
+		t.Error("didn't choose child with higher RAVE win rate")
+	}
+	if n.selectChild(0.0, 0) != unlikely {
+		t.Error("expected first unvisited child when RAVE is turned off")
+	}
+}
+
+func TestUpdateRave(t *testing.T) {
+	b := makeBoard(`
+...
+...
+...`)
+	black := &node{move: b.makePt(1, 1), color: BLACK}
+	white := &node{move: b.makePt(2, 2), color: WHITE}
+	unplayed := &node{move: b.makePt(3, 3), color: BLACK}
+	n := &node{children: []*node{black, white, unplayed}}
+
+	amaf := make([]cell, len(b.cells))
+	amaf[b.makePt(1, 1)] = BLACK
+	amaf[b.makePt(2, 2)] = BLACK // first played by the other side
+	n.updateRave(amaf, 1.0)
+
+	assertEqualsInt(t, 1, black.raveVisits, "black child should be counted")
+	if black.raveWins != 1.0 {
+		t.Errorf("expected a win for black but got %v", black.raveWins)
+	}
+	assertEqualsInt(t, 0, white.raveVisits, "white child shouldn't be counted")
+	assertEqualsInt(t, 0, unplayed.raveVisits, "unplayed child shouldn't be counted")
+}